@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the configuration",
+	Long:  `Show and change the settings saved in snett.toml.`,
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Show the config file path",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(appConfig.Path())
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the settings",
+	Long:  `List every setting with its value, including SNETT_* environment overrides.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := appConfig.Settings()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, key := range appConfig.Keys() {
+			fmt.Fprintf(w, "%v\t%v\n", key, settings[key])
+		}
+		w.Flush()
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Show a setting",
+	Long:  `Show the value of a setting, such as server.port.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		value, err := appConfig.Get(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(value)
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a setting",
+	Long:  `Change a setting, such as server.port, and save it. Lists are given as comma separated values.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		fileConfig := loadConfigFile()
+
+		if err := fileConfig.Set(args[0], args[1]); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := fileConfig.Save(); err != nil {
+			log.Fatalf("Failed to save %v: %v", fileConfig.Path(), err)
+		}
+	},
+}
+
+var configResetCmd = &cobra.Command{
+	Use:   "reset [key]",
+	Short: "Reset settings to their defaults",
+	Long:  `Reset a setting, or every setting when no key is given, to its default value and save it.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fileConfig := loadConfigFile()
+
+		key := ""
+		if len(args) > 0 {
+			key = args[0]
+		}
+
+		if err := fileConfig.Reset(key); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := fileConfig.Save(); err != nil {
+			log.Fatalf("Failed to save %v: %v", fileConfig.Path(), err)
+		}
+	},
+}
+
+var configProfileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage the config profiles",
+	Long:  `Profiles are named sets of server and notification settings, such as "home" or "office", applied over the rest of the config.`,
+}
+
+var configProfileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the profiles",
+	Long:  `List the profiles and their settings. The active profile is marked with *.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, name := range appConfig.ProfileNames() {
+			active := " "
+			if strings.EqualFold(name, appConfig.Profile) {
+				active = "*"
+			}
+
+			settings := appConfig.Profiles[name]
+
+			var values []string
+			for _, key := range slices.Sorted(maps.Keys(settings)) {
+				values = append(values, fmt.Sprintf("%v=%v", key, settings[key]))
+			}
+
+			fmt.Fprintf(w, "%v %v\t%v\n", active, name, strings.Join(values, " "))
+		}
+		w.Flush()
+	},
+}
+
+var configProfileUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Choose the active profile",
+	Long:  `Choose the profile applied by every command. "config reset profile" stops using profiles.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fileConfig := loadConfigFile()
+
+		if err := fileConfig.Set("profile", args[0]); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := fileConfig.Save(); err != nil {
+			log.Fatalf("Failed to save %v: %v", fileConfig.Path(), err)
+		}
+	},
+}
+
+var configProfileCreateCmd = &cobra.Command{
+	Use:   "create <name> [key=value ...]",
+	Short: "Create a profile",
+	Long:  `Create a profile overriding the given server and notification settings, such as allowUploads=true allowNotif=false.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		fileConfig := loadConfigFile()
+
+		settings := map[string]string{}
+		for _, arg := range args[1:] {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				log.Fatalf("Expected key=value, got %q", arg)
+			}
+
+			settings[key] = value
+		}
+
+		if err := fileConfig.CreateProfile(args[0], settings); err != nil {
+			log.Fatal(err)
+		}
+
+		if err := fileConfig.Save(); err != nil {
+			log.Fatalf("Failed to save %v: %v", fileConfig.Path(), err)
+		}
+	},
+}
+
+// loadConfigFile loads the config file without the profile and
+// environment overrides, so they are not saved along with a change
+func loadConfigFile() *config.AppConfig {
+	fileConfig, err := config.LoadFile(appConfig.Path())
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	return fileConfig
+}
+
+// isConfigCommand reports whether cmd is one of the config commands
+func isConfigCommand(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c == configCmd {
+			return true
+		}
+	}
+
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configPathCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configResetCmd)
+	configCmd.AddCommand(configProfileCmd)
+	configProfileCmd.AddCommand(configProfileListCmd)
+	configProfileCmd.AddCommand(configProfileUseCmd)
+	configProfileCmd.AddCommand(configProfileCreateCmd)
+}
@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 
 	"github.com/Owbird/SNetT-Engine/internal/logger"
+	"github.com/Owbird/SNetT-Engine/internal/qr"
+	"github.com/Owbird/SNetT-Engine/pkg/config"
 	"github.com/spf13/cobra"
 )
 
@@ -12,6 +17,36 @@ var rootCmd = &cobra.Command{
 	Use:   "SNetT-Engine",
 	Short: "SNetT Cli",
 	Long:  `SNetT is a collection of network tools for easy file sharing and management.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		profile, _ := cmd.Flags().GetString("profile")
+
+		appConfig = loadConfig(configPath, profile)
+		serverConfig = appConfig.GetSeverConfig()
+		notifConfig = appConfig.GetNotifConfig()
+		logConfig = appConfig.GetLogConfig()
+
+		if cmd.Flags().Changed("log-level") {
+			logConfig.Level, _ = cmd.Flags().GetString("log-level")
+		}
+
+		if cmd.Flags().Changed("log-format") {
+			logConfig.Format, _ = cmd.Flags().GetString("log-format")
+		}
+
+		if cmd.Flags().Changed("quiet") {
+			logConfig.Quiet, _ = cmd.Flags().GetBool("quiet")
+		}
+
+		if err := logger.Init(logConfig.Options()); err != nil {
+			logger.Logger.Warn("Logging is partly disabled", "err", err)
+		}
+
+		// The config commands stay usable to fix an invalid config
+		if !isConfigCommand(cmd) {
+			validateConfig()
+		}
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -23,6 +58,57 @@ func Execute() {
 	}
 }
 
+// loadConfig loads the config at path, or ~/.snett/snett.toml
+// when path is empty, with the named profile or the one chosen
+// in the file. The default configuration is written on the
+// first run.
+func loadConfig(path string, profile string) *config.AppConfig {
+	fileConfig, err := config.LoadFile(path)
+	if err != nil {
+		logger.Logger.Error("Failed to load config", "err", err)
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(fileConfig.Path()); errors.Is(err, fs.ErrNotExist) {
+		if err := fileConfig.Save(); err != nil {
+			logger.Logger.Warn("Failed to save the default config", "err", err)
+		}
+	}
+
+	appConfig, err := config.LoadProfile(fileConfig.Path(), profile)
+	if err != nil {
+		logger.Logger.Error("Failed to load config", "err", err)
+		os.Exit(1)
+	}
+
+	return appConfig
+}
+
+// validateConfig exits with the invalid settings, if any
+func validateConfig() {
+	if err := appConfig.Validate(); err != nil {
+		logger.Logger.Error("Invalid config", "path", appConfig.Path(), "err", err)
+		os.Exit(1)
+	}
+}
+
+// printQR shows text as a QR code in the terminal
+func printQR(text string) {
+	code, err := qr.Terminal(text)
+	if err != nil {
+		logger.Logger.Error("Failed to render QR code", "err", err)
+		return
+	}
+
+	fmt.Print(code)
+}
+
 func init() {
-	logger.Init()
+	logConfig := config.Default().GetLogConfig()
+
+	rootCmd.PersistentFlags().String("config", "", "Config file (default ~/.snett/snett.toml)")
+	rootCmd.PersistentFlags().String("profile", "", "Config profile to use in place of the one chosen in the config file")
+	rootCmd.PersistentFlags().String("log-level", logConfig.Level, "Minimum level to log: debug, info, warn or error")
+	rootCmd.PersistentFlags().String("log-format", logConfig.Format, "Log format: text or json")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", logConfig.Quiet, "Only log errors to the console")
 }
@@ -1,20 +1,27 @@
 package cmd
 
 import (
+	"bufio"
+	"fmt"
 	"os"
+	"strings"
 	"sync"
 
 	"github.com/Owbird/SNetT-Engine/internal/logger"
+	"github.com/Owbird/SNetT-Engine/internal/utils"
 	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
 	"github.com/Owbird/SNetT-Engine/pkg/models"
 	"github.com/Owbird/SNetT-Engine/pkg/server"
 	"github.com/spf13/cobra"
 )
 
+// The loaded config, set before any command runs
 var (
-	appConfig    = config.NewAppConfig()
-	serverConfig = appConfig.GetSeverConfig()
-	notifConfig  = appConfig.GetNotifConfig()
+	appConfig    *config.AppConfig
+	serverConfig *config.ServerConfig
+	notifConfig  *config.NotifConfig
+	logConfig    *config.LogConfig
 )
 
 var serverCmd = &cobra.Command{
@@ -34,6 +41,8 @@ var startCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
+		showQR, _ := cmd.Flags().GetBool("qr")
+
 		logCh := make(chan models.ServerLog)
 		defer close(logCh)
 
@@ -44,10 +53,22 @@ var startCmd = &cobra.Command{
 					logger.Logger.Info("API Log", "value", l.Value)
 				case models.SERVE_UI_LOCAL:
 					logger.Logger.Info("Network Web Running", "value", l.Value)
+					if showQR {
+						printQR(l.Value)
+					}
 				case models.SERVE_UI_REMOTE:
 					logger.Logger.Info("Remote Web Running", "value", l.Value)
+					if showQR {
+						printQR(l.Value)
+					}
 				case models.WS_NEW_VISITOR:
 					logger.Logger.Info("New visitor", "value", l.Value)
+				case models.TUNNEL_STATUS:
+					logger.Logger.Info("Tunnel Status", "value", l.Value)
+				case models.TUNNEL_UP:
+					logger.Logger.Info("Tunnel Up", "value", l.Value)
+				case models.TUNNEL_DOWN:
+					logger.Logger.Warn("Tunnel Down", "value", l.Value)
 				case models.SERVER_ERROR:
 					logger.Logger.Error("Server Error", "value", l.Value)
 				default:
@@ -56,10 +77,7 @@ var startCmd = &cobra.Command{
 			}
 		}()
 
-		server := server.NewServer(dir, logCh)
-
-		port, _ := cmd.Flags().GetInt("port")
-		serverName, _ := cmd.Flags().GetString("name")
+		server := server.NewServer(dir, appConfig, logCh)
 
 		if cmd.Flags().Changed("uploads") {
 			serverConfig.AllowUploads = true
@@ -79,31 +97,118 @@ var startCmd = &cobra.Command{
 			notifConfig.AllowNotif = false
 		}
 
-		serverConfig.Port = port
-		serverConfig.Name = serverName
+		if cmd.Flags().Changed("port") {
+			serverConfig.Port, _ = cmd.Flags().GetInt("port")
+		}
+
+		if cmd.Flags().Changed("name") {
+			serverConfig.Name, _ = cmd.Flags().GetString("name")
+		}
+
+		if cmd.Flags().Changed("interface") {
+			serverConfig.Interfaces, _ = cmd.Flags().GetStringArray("interface")
+		}
+
+		if cmd.Flags().Changed("bind") {
+			serverConfig.Bind, _ = cmd.Flags().GetString("bind")
+		}
+
+		if cmd.Flags().Changed("access-log") {
+			logConfig.AccessLog, _ = cmd.Flags().GetBool("access-log")
+		}
+
+		if cmd.Flags().Changed("access-log-format") {
+			logConfig.AccessLog = true
+			logConfig.AccessLogFormat, _ = cmd.Flags().GetString("access-log-format")
+		}
+
+		if cmd.Flags().Changed("metrics") {
+			serverConfig.Metrics, _ = cmd.Flags().GetBool("metrics")
+		}
+
+		if cmd.Flags().Changed("approve-uploads") {
+			serverConfig.ApproveUploads, _ = cmd.Flags().GetBool("approve-uploads")
+		}
+
+		if cmd.Flags().Changed("port-fallback") {
+			serverConfig.PortFallback, _ = cmd.Flags().GetString("port-fallback")
+		}
+
+		if cmd.Flags().Changed("bandwidth") {
+			serverConfig.Limits.Bandwidth, _ = cmd.Flags().GetInt("bandwidth")
+		}
+
+		if cmd.Flags().Changed("visitor-bandwidth") {
+			serverConfig.Limits.VisitorBandwidth, _ = cmd.Flags().GetInt("visitor-bandwidth")
+		}
+
+		if cmd.Flags().Changed("max-downloads") {
+			serverConfig.Limits.MaxDownloads, _ = cmd.Flags().GetInt("max-downloads")
+		}
+
+		if cmd.Flags().Changed("files-per-minute") {
+			serverConfig.Limits.FilesPerMinute, _ = cmd.Flags().GetInt("files-per-minute")
+		}
+
+		validateConfig()
+
+		if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+			go promptUploads(server)
+		}
 
 		wg := sync.WaitGroup{}
 
 		wg.Add(1)
-		go server.Start(*appConfig)
+		go server.Start()
 
 		wg.Wait()
 	},
 }
 
+// promptUploads asks on the terminal whether to approve
+// each upload that waits for approval
+func promptUploads(svr *server.Server) {
+	sub := svr.Events().Subscribe(events.UPLOAD_PENDING)
+	defer sub.Close()
+
+	input := bufio.NewReader(os.Stdin)
+
+	for envelope := range sub.C() {
+		pending := envelope.Event.(events.UploadPending)
+
+		fmt.Printf("Approve upload of %v (%v) from %v? [y/N] ", pending.Path, utils.FmtBytes(pending.Size), pending.Visitor)
+
+		answer, err := input.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			err = svr.ApproveUpload(pending.ID)
+		default:
+			err = svr.RejectUpload(pending.ID)
+		}
+
+		if err != nil {
+			logger.Logger.Error("Failed to decide upload", "id", pending.ID, "err", err)
+		}
+	}
+}
+
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List available servers on the network",
 	Long:  `List reveals the broadcasted servers on the network for easy access.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		server := server.NewServer("", nil)
+		server := server.NewServer("", appConfig, nil)
 		servers := make(chan models.SNetTServer)
 
 		go server.List(servers)
 
 		idx := 1
 		for s := range servers {
-			logger.Logger.Info("Server found", "index", idx, "name", s.Name, "ip", s.IP, "port", s.Port)
+			logger.Logger.Info("Server found", "index", idx, "name", s.Name, "ip", s.IP, "port", s.Port, "ips", s.IPs)
 			idx++
 		}
 	},
@@ -114,14 +219,31 @@ func init() {
 	serverCmd.AddCommand(startCmd)
 	serverCmd.AddCommand(listCmd)
 
+	defaults := config.Default()
+	serverConfig := defaults.GetSeverConfig()
+	notifConfig := defaults.GetNotifConfig()
+	logConfig := defaults.GetLogConfig()
+
 	startCmd.Flags().StringP("dir", "d", "", "Directory to serve")
 	startCmd.Flags().StringP("name", "n", serverConfig.Name, "Server name")
 	startCmd.Flags().IntP("port", "p", serverConfig.Port, "Port to host on")
+	startCmd.Flags().StringArrayP("interface", "i", serverConfig.Interfaces, "Network interface to serve and advertise on (repeatable, all when unset)")
+	startCmd.Flags().String("bind", serverConfig.Bind, "Address to bind to, such as 0.0.0.0, :: or a single IP")
+	startCmd.Flags().String("port-fallback", serverConfig.PortFallback, "When the port is in use: none, next (try the following ports) or random")
 
 	startCmd.Flags().Bool("uploads", serverConfig.AllowUploads, "Allow uploads to directory")
 	startCmd.Flags().Bool("no-uploads", !serverConfig.AllowUploads, "Do not allow uploads to directory")
+	startCmd.Flags().Bool("approve-uploads", serverConfig.ApproveUploads, "Keep uploads in quarantine until approved")
 	startCmd.Flags().Bool("online", serverConfig.AllowOnline, "Allow online access to server")
 	startCmd.Flags().Bool("no-online", !serverConfig.AllowOnline, "Do not allow online access to server")
+	startCmd.Flags().Bool("access-log", logConfig.AccessLog, "Write HTTP requests to ~/.snett/logs/access.log")
+	startCmd.Flags().String("access-log-format", logConfig.AccessLogFormat, "Access log format: combined or json")
+	startCmd.Flags().Bool("metrics", serverConfig.Metrics, "Serve Prometheus metrics on /metrics")
+	startCmd.Flags().Int("bandwidth", serverConfig.Limits.Bandwidth, "Bandwidth shared by all visitors in KiB/s (0 for unlimited)")
+	startCmd.Flags().Int("visitor-bandwidth", serverConfig.Limits.VisitorBandwidth, "Bandwidth of each visitor in KiB/s (0 for unlimited)")
+	startCmd.Flags().Int("max-downloads", serverConfig.Limits.MaxDownloads, "Downloads served at once (0 for unlimited)")
+	startCmd.Flags().Int("files-per-minute", serverConfig.Limits.FilesPerMinute, "Directory listings each visitor may request per minute (0 for unlimited)")
+	startCmd.Flags().Bool("qr", true, "Show the server URLs as QR codes")
 	startCmd.Flags().Bool("notify", notifConfig.AllowNotif, "Allow notifications")
 	startCmd.Flags().Bool("no-notify", !notifConfig.AllowNotif, "Do not allow notifications")
 
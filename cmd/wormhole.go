@@ -1,8 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
+	"github.com/Owbird/SNetT-Engine/internal/logger"
+	"github.com/Owbird/SNetT-Engine/internal/qr"
+	"github.com/Owbird/SNetT-Engine/internal/utils"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+	"github.com/Owbird/SNetT-Engine/pkg/hooks"
 	"github.com/Owbird/SNetT-Engine/pkg/models"
 	"github.com/Owbird/SNetT-Engine/pkg/wormhole"
 	"github.com/spf13/cobra"
@@ -16,43 +28,192 @@ var wormholeCmd = &cobra.Command{
 
 var sendCmd = &cobra.Command{
 	Use:   "share",
-	Short: "Share file to device via the wormhole",
-	Long:  `Send a file through the wormhole to another device using the magic key.`,
+	Short: "Share files to device via the wormhole",
+	Long:  `Send one or more files through the wormhole to another device using the magic key.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		svr := wormhole.NewWormhole(nil)
-		file, err := cmd.Flags().GetString("file")
+		svr := wormhole.NewWormhole(appConfig)
+		files, err := cmd.Flags().GetStringArray("file")
 		if err != nil {
 			log.Fatalf("Failed to get 'file' flag: %v", err)
 		}
 
-		svr.Share(file, wormhole.ShareCallBacks{
-			OnSendErr: func(err error) {
-				log.Fatalf("Send error: %s", err)
-			},
-			OnFileSent: func() {
-				log.Println("File sent!")
-			},
-			OnCodeReceive: func(code string) {
-				log.Println("Code: ", code)
-			},
-			OnProgressChange: func(progress models.FileShareProgress) {
-				log.Printf("Sent: %v/%v (%v%%)", progress.Bytes, progress.Total, progress.Percentage)
-			},
-		})
+		svr.PairingTimeout, _ = cmd.Flags().GetDuration("timeout")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		closeHooks := startHooks(svr)
+
+		err = svr.ShareFiles(ctx, files, newShareCallBacks(cmd)).Wait()
+		closeHooks()
+
+		if err != nil {
+			log.Fatalf("Send error: %s", err)
+		}
 	},
 }
 
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past wormhole transfers",
+	Long:  `List the files sent and received through the wormhole, newest last.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		svr := wormhole.NewWormhole(appConfig)
+		if svr.History == nil {
+			log.Fatalf("Transfer history is unavailable")
+		}
+
+		direction, _ := cmd.Flags().GetString("direction")
+		outcome, _ := cmd.Flags().GetString("outcome")
+		name, _ := cmd.Flags().GetString("name")
+		since, _ := cmd.Flags().GetDuration("since")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		filter := wormhole.HistoryFilter{
+			Direction: models.TransferDirection(direction),
+			Outcome:   models.TransferOutcome(outcome),
+			Name:      name,
+			Limit:     limit,
+		}
+
+		if since > 0 {
+			filter.Since = time.Now().Add(-since)
+		}
+
+		records, err := svr.History.List(filter)
+		if err != nil {
+			log.Fatalf("Failed to read transfer history: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDIRECTION\tNAME\tSIZE\tFILES\tSTARTED\tDURATION\tOUTCOME")
+
+		for _, record := range records {
+			fmt.Fprintf(
+				w,
+				"%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+				record.ID,
+				record.Direction,
+				record.Name,
+				utils.FmtBytes(record.Size),
+				len(record.Files),
+				record.StartedAt.Format(time.DateTime),
+				record.FinishedAt.Sub(record.StartedAt).Round(time.Second),
+				record.Outcome,
+			)
+		}
+
+		w.Flush()
+	},
+}
+
+var resendCmd = &cobra.Command{
+	Use:   "resend <id>",
+	Short: "Share the files of a past transfer again",
+	Long:  `Share the files of a transfer from the history again with a fresh magic key.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		svr := wormhole.NewWormhole(appConfig)
+
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			log.Fatalf("Invalid transfer id %q", args[0])
+		}
+
+		svr.PairingTimeout, _ = cmd.Flags().GetDuration("timeout")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		closeHooks := startHooks(svr)
+
+		transfer, err := svr.Resend(ctx, id, newShareCallBacks(cmd))
+		if err != nil {
+			closeHooks()
+			log.Fatalf("Failed to resend transfer %v: %v", id, err)
+		}
+
+		err = transfer.Wait()
+		closeHooks()
+
+		if err != nil {
+			log.Fatalf("Send error: %s", err)
+		}
+	},
+}
+
+// startHooks runs the configured hooks for the transfer events
+// of svr. The returned func waits for the hooks to finish.
+func startHooks(svr *wormhole.Wormhole) func() {
+	bus := events.NewBus()
+	svr.Events = bus
+
+	transferHooks := hooks.NewHooks(appConfig.GetHooksConfig(), logger.Logger)
+	transferHooks.Listen(context.Background(), bus)
+
+	return transferHooks.Close
+}
+
+// newShareCallBacks logs the progress of a share to the terminal
+// and shows the code as a QR code if requested by the flags
+func newShareCallBacks(cmd *cobra.Command) wormhole.ShareCallBacks {
+	showQR, _ := cmd.Flags().GetBool("qr")
+	qrPNG, _ := cmd.Flags().GetString("qr-png")
+
+	return wormhole.ShareCallBacks{
+		OnFileSent: func() {
+			log.Println("File sent!")
+		},
+		OnCodeReceive: func(code string) {
+			log.Println("Code: ", code)
+
+			if showQR {
+				printQR(wormhole.CodeURI(code))
+			}
+
+			if qrPNG != "" {
+				if err := qr.WritePNG(wormhole.CodeURI(code), qr.DefaultPNGSize, qrPNG); err != nil {
+					log.Printf("Failed to save QR code: %v", err)
+				}
+			}
+		},
+		OnProgressChange: func(progress models.FileShareProgress) {
+			log.Printf("Sent: %v/%v (%v%%)", progress.Bytes, progress.Total, progress.Percentage)
+		},
+		OnFileProgressChange: func(file string, progress models.FileShareProgress) {
+			log.Printf("%v: %v/%v (%v%%)", file, progress.Bytes, progress.Total, progress.Percentage)
+		},
+	}
+}
+
 var RecvCommand = &cobra.Command{
 	Use:   "receive",
 	Short: "Receive file from device via the wormhole",
 	Long:  `Receive a file using the magic key from another device through the wormhole.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		server := wormhole.NewWormhole(nil)
+		server := wormhole.NewWormhole(appConfig)
 		code, err := cmd.Flags().GetString("code")
 		if err != nil {
 			log.Fatalf("Failed to get 'code' flag: %v", err)
 		}
-		if err := server.Receive(code); err != nil {
+
+		server.PairingTimeout, _ = cmd.Flags().GetDuration("timeout")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		dir, _ := cmd.Flags().GetString("dir")
+
+		closeHooks := startHooks(server)
+
+		err = server.ReceiveTo(ctx, code, dir, wormhole.ReceiveCallBacks{
+			OnFileReceived: func(path string) {
+				log.Println("File saved to", path)
+			},
+		}).Wait()
+		closeHooks()
+
+		if err != nil {
 			log.Fatalf("Failed to receive file: %v", err)
 		}
 	},
@@ -63,10 +224,29 @@ func init() {
 
 	wormholeCmd.AddCommand(sendCmd)
 	wormholeCmd.AddCommand(RecvCommand)
+	wormholeCmd.AddCommand(historyCmd)
+	wormholeCmd.AddCommand(resendCmd)
 
-	sendCmd.Flags().StringP("file", "f", "", "File to share")
+	sendCmd.Flags().StringArrayP("file", "f", []string{}, "File to share (repeat to share several files with one code)")
+
+	sendCmd.Flags().Duration("timeout", wormhole.DefaultPairingTimeout, "How long to wait for the other device (0 waits forever)")
 
 	RecvCommand.Flags().StringP("code", "c", "", "Code from other device")
+	RecvCommand.Flags().StringP("dir", "d", "", "Directory to save to, such as a served directory (default ~/Downloads/snett)")
+	RecvCommand.Flags().Duration("timeout", wormhole.DefaultPairingTimeout, "How long to wait for the other device (0 waits forever)")
+
+	historyCmd.Flags().String("direction", "", "Only show transfers in this direction (sent or received)")
+	historyCmd.Flags().String("outcome", "", "Only show transfers with this outcome (completed, failed or cancelled)")
+	historyCmd.Flags().String("name", "", "Only show transfers whose name contains this text")
+	historyCmd.Flags().Duration("since", 0, "Only show transfers started within this duration, e.g. 24h")
+	historyCmd.Flags().IntP("limit", "l", 0, "Only show the latest transfers")
+
+	resendCmd.Flags().Duration("timeout", wormhole.DefaultPairingTimeout, "How long to wait for the other device (0 waits forever)")
+
+	for _, c := range []*cobra.Command{sendCmd, resendCmd} {
+		c.Flags().Bool("qr", true, "Show the code as a QR code")
+		c.Flags().String("qr-png", "", "Save the code as a QR code PNG image to this path")
+	}
 
 	sendCmd.MarkFlagRequired("file")
 	RecvCommand.MarkFlagRequired("code")
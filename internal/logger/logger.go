@@ -1,35 +1,255 @@
 package logger
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/Owbird/SNetT-Engine/internal/utils"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var Logger *slog.Logger
+// Logger is the application logger. It is the default slog
+// logger until Init is called, so packages used as a library
+// can always log through it.
+var Logger = slog.Default()
 
-func Init() {
+const (
+	// Log formats
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+const (
+	// Log destinations
+	DEST_STDOUT = "stdout"
+	DEST_STDERR = "stderr"
+	DEST_FILE   = "file"
+)
+
+// Options configure the application logger
+type Options struct {
+	// Minimum level to log: debug, info, warn or error
+	Level string
+
+	// Format of the log lines: text or json
+	Format string
+
+	// Where to log: stdout, stderr and/or file
+	Destinations []string
+
+	// Only log errors to stdout and stderr.
+	// The log file still gets every level.
+	Quiet bool
+
+	// How the log file is rotated
+	Rotate RotateConfig
+}
+
+// DefaultOptions log info and above as text to stdout and the log file
+var DefaultOptions = Options{
+	Level:        "info",
+	Format:       FORMAT_TEXT,
+	Destinations: []string{DEST_STDOUT, DEST_FILE},
+	Rotate:       DefaultRotateConfig,
+}
+
+// RotateConfig controls when log files are rotated
+// and how many rotated files are kept
+type RotateConfig struct {
+	// Size in megabytes a log file grows to before it is rotated
+	MaxSize int
+
+	// Days to keep rotated log files. Zero keeps them all.
+	MaxAge int
+
+	// How many rotated log files to keep. Zero keeps them all.
+	MaxBackups int
+
+	// Whether to gzip rotated log files
+	Compress bool
+}
+
+// DefaultRotateConfig is used when no rotation is configured
+var DefaultRotateConfig = RotateConfig{
+	MaxSize:    10,
+	MaxAge:     28,
+	MaxBackups: 5,
+	Compress:   true,
+}
+
+// LogsDir returns the directory the log files are written to
+func LogsDir() (string, error) {
 	snettDir, err := utils.GetSNetTDir()
 	if err != nil {
-		slog.Error("failed to get snett dir", "err", err)
-		os.Exit(1)
+		return "", err
 	}
 
 	logsDir := filepath.Join(snettDir, "logs")
 	if err := os.MkdirAll(logsDir, 0755); err != nil {
-		slog.Error("failed to create logs directory", "err", err)
-		os.Exit(1)
+		return "", err
 	}
 
-	logFile, err := os.OpenFile(filepath.Join(logsDir, "snett.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	return logsDir, nil
+}
+
+// OpenFile opens a log file in the logs directory
+// that is rotated as configured
+func OpenFile(name string, rotate RotateConfig) (io.WriteCloser, error) {
+	logsDir, err := LogsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if rotate.MaxSize <= 0 {
+		rotate.MaxSize = DefaultRotateConfig.MaxSize
+	}
+
+	return &lumberjack.Logger{
+		Filename:   filepath.Join(logsDir, name),
+		MaxSize:    rotate.MaxSize,
+		MaxAge:     rotate.MaxAge,
+		MaxBackups: rotate.MaxBackups,
+		Compress:   rotate.Compress,
+		LocalTime:  true,
+	}, nil
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
+	}
+
+	return l, nil
+}
+
+// New returns a logger for the options. A destination that cannot
+// be opened, such as a read-only log directory, is left out and
+// reported in the error, but the logger is still usable.
+func New(opts Options) (*slog.Logger, error) {
+	var errs []error
+
+	level, err := ParseLevel(opts.Level)
 	if err != nil {
-		slog.Error("failed to open log file", "err", err)
-		os.Exit(1)
+		errs = append(errs, err)
+	}
+
+	format := strings.ToLower(opts.Format)
+	switch format {
+	case "", FORMAT_TEXT, FORMAT_JSON:
+	default:
+		errs = append(errs, fmt.Errorf("unknown log format %q", opts.Format))
+		format = FORMAT_TEXT
+	}
+
+	consoleLevel := level
+	if opts.Quiet {
+		consoleLevel = max(level, slog.LevelError)
+	}
+
+	handlers := []slog.Handler{}
+
+	for _, dest := range opts.Destinations {
+		switch strings.ToLower(dest) {
+		case DEST_STDOUT:
+			handlers = append(handlers, newHandler(os.Stdout, format, consoleLevel))
+		case DEST_STDERR:
+			handlers = append(handlers, newHandler(os.Stderr, format, consoleLevel))
+		case DEST_FILE:
+			logFile, err := OpenFile("snett.log", opts.Rotate)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to open log file: %w", err))
+				continue
+			}
+			handlers = append(handlers, newHandler(logFile, format, level))
+		default:
+			errs = append(errs, fmt.Errorf("unknown log destination %q", dest))
+		}
+	}
+
+	if len(handlers) == 0 {
+		handlers = append(handlers, newHandler(io.Discard, format, level))
+	}
+
+	if len(handlers) == 1 {
+		return slog.New(handlers[0]), errors.Join(errs...)
+	}
+
+	return slog.New(multiHandler(handlers)), errors.Join(errs...)
+}
+
+// Init sets Logger from the options. Logger is set
+// even when some of the destinations failed.
+func Init(opts Options) error {
+	l, err := New(opts)
+	Logger = l
+
+	return err
+}
+
+func newHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	handlerOpts := &slog.HandlerOptions{
+		Level: level,
+	}
+
+	if format == FORMAT_JSON {
+		return slog.NewJSONHandler(w, handlerOpts)
+	}
+
+	return slog.NewTextHandler(w, handlerOpts)
+}
+
+// multiHandler sends each record to every handler enabled for its level
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+
+	for _, h := range m {
+		if h.Enabled(ctx, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
 	}
 
-	handler := slog.NewTextHandler(io.MultiWriter(os.Stdout, logFile), nil)
-	Logger = slog.New(handler)
+	return handlers
 }
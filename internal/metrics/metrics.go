@@ -0,0 +1,299 @@
+// Package metrics provides counters, gauges and histograms
+// exposed in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Latency buckets in seconds for request durations
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// Registry holds the metrics to expose
+type Registry struct {
+	metrics []*metric
+	mutex   sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// metric is a named metric with a series per label values
+type metric struct {
+	name       string
+	help       string
+	metricType metricType
+	labelNames []string
+	buckets    []float64
+
+	series map[string]*series
+	mutex  sync.Mutex
+}
+
+type series struct {
+	labelValues []string
+
+	// The value of counters and gauges, the sum of histograms
+	value float64
+
+	// Observations per bucket and in total, for histograms
+	bucketCounts []uint64
+	count        uint64
+}
+
+func (r *Registry) register(m *metric) *metric {
+	m.series = make(map[string]*series)
+
+	r.mutex.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mutex.Unlock()
+
+	return m
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	metric *metric
+}
+
+// Counter registers a counter with the given label names
+func (r *Registry) Counter(name string, help string, labelNames ...string) *Counter {
+	return &Counter{
+		metric: r.register(&metric{
+			name:       name,
+			help:       help,
+			metricType: counterType,
+			labelNames: labelNames,
+		}),
+	}
+}
+
+// Add increases the counter for the label values. It
+// does nothing on a nil counter.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+
+	c.metric.update(labelValues, func(s *series) {
+		s.value += value
+	})
+}
+
+// Inc increases the counter for the label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Gauge is a value that goes up and down
+type Gauge struct {
+	metric *metric
+}
+
+// Gauge registers a gauge with the given label names
+func (r *Registry) Gauge(name string, help string, labelNames ...string) *Gauge {
+	return &Gauge{
+		metric: r.register(&metric{
+			name:       name,
+			help:       help,
+			metricType: gaugeType,
+			labelNames: labelNames,
+		}),
+	}
+}
+
+// Set sets the gauge for the label values. It
+// does nothing on a nil gauge.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+
+	g.metric.update(labelValues, func(s *series) {
+		s.value = value
+	})
+}
+
+// Add changes the gauge for the label values by value
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+
+	g.metric.update(labelValues, func(s *series) {
+		s.value += value
+	})
+}
+
+// Histogram counts observations, such as request durations, in buckets
+type Histogram struct {
+	metric *metric
+}
+
+// Histogram registers a histogram with the given
+// bucket upper bounds and label names
+func (r *Registry) Histogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	return &Histogram{
+		metric: r.register(&metric{
+			name:       name,
+			help:       help,
+			metricType: histogramType,
+			labelNames: labelNames,
+			buckets:    buckets,
+		}),
+	}
+}
+
+// Observe records a value for the label values. It
+// does nothing on a nil histogram.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+
+	h.metric.update(labelValues, func(s *series) {
+		if s.bucketCounts == nil {
+			s.bucketCounts = make([]uint64, len(h.metric.buckets))
+		}
+
+		for i, bound := range h.metric.buckets {
+			if value <= bound {
+				s.bucketCounts[i]++
+			}
+		}
+
+		s.value += value
+		s.count++
+	})
+}
+
+func (m *metric) update(labelValues []string, fn func(s *series)) {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("metrics: %v expects %v label values, got %v", m.name, len(m.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s, found := m.series[key]
+	if !found {
+		s = &series{
+			labelValues: slices.Clone(labelValues),
+		}
+		m.series[key] = s
+	}
+
+	fn(s)
+}
+
+// WriteText writes every metric in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mutex.Unlock()
+
+	var b strings.Builder
+
+	for _, m := range metrics {
+		m.writeText(&b)
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func (m *metric) writeText(b *strings.Builder) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fmt.Fprintf(b, "# HELP %v %v\n", m.name, escapeHelp(m.help))
+	fmt.Fprintf(b, "# TYPE %v %v\n", m.name, m.metricType)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+
+		if m.metricType != histogramType {
+			fmt.Fprintf(b, "%v%v %v\n", m.name, labels(m.labelNames, s.labelValues), formatValue(s.value))
+			continue
+		}
+
+		for i, bound := range m.buckets {
+			fmt.Fprintf(b, "%v_bucket%v %v\n", m.name, labels(append(slices.Clone(m.labelNames), "le"), append(slices.Clone(s.labelValues), formatValue(bound))), s.bucketCounts[i])
+		}
+
+		fmt.Fprintf(b, "%v_bucket%v %v\n", m.name, labels(append(slices.Clone(m.labelNames), "le"), append(slices.Clone(s.labelValues), "+Inf")), s.count)
+		fmt.Fprintf(b, "%v_sum%v %v\n", m.name, labels(m.labelNames, s.labelValues), formatValue(s.value))
+		fmt.Fprintf(b, "%v_count%v %v\n", m.name, labels(m.labelNames, s.labelValues), s.count)
+	}
+}
+
+// labels formats label pairs as {name="value",...}
+func labels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%v=\"%v\"", name, escapeLabel(values[i]))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+
+		r.WriteText(w)
+	})
+}
@@ -0,0 +1,61 @@
+// Package qr renders QR codes for share codes and
+// server URLs in the terminal and as images
+package qr
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// DefaultPNGSize is the width and height in pixels
+// of generated PNG images
+const DefaultPNGSize = 256
+
+// MaxTextLength is the longest text that will be encoded
+const MaxTextLength = 1024
+
+func newQRCode(text string) (*qrcode.QRCode, error) {
+	if len(text) == 0 {
+		return nil, fmt.Errorf("no text to encode")
+	}
+
+	if len(text) > MaxTextLength {
+		return nil, fmt.Errorf("text is longer than %v characters", MaxTextLength)
+	}
+
+	return qrcode.New(text, qrcode.Medium)
+}
+
+// Terminal renders text as a QR code made of half-block
+// characters, two modules per character row.
+// Light modules are drawn so the code scans on dark terminals.
+func Terminal(text string) (string, error) {
+	q, err := newQRCode(text)
+	if err != nil {
+		return "", err
+	}
+
+	return q.ToSmallString(false), nil
+}
+
+// PNG renders text as a QR code PNG image of size by size pixels
+func PNG(text string, size int) ([]byte, error) {
+	q, err := newQRCode(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.PNG(size)
+}
+
+// WritePNG saves text as a QR code PNG image to path
+func WritePNG(text string, size int, path string) error {
+	png, err := PNG(text, size)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, png, 0644)
+}
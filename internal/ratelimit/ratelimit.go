@@ -0,0 +1,355 @@
+// Package ratelimit provides token bucket limiters for
+// requests and for the bytes read from or written to streams
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket refilled with rate tokens per
+// second and holding up to burst tokens
+type Limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+// NewLimiter returns a limiter allowing rate tokens per second
+// with bursts of up to burst tokens. It allows everything when
+// rate is zero or less.
+func NewLimiter(rate float64, burst int) *Limiter {
+	l := &Limiter{}
+	l.SetLimit(rate, burst)
+
+	return l
+}
+
+// SetLimit changes the rate and burst of the limiter,
+// such as after the configuration has changed
+func (l *Limiter) SetLimit(rate float64, burst int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !l.last.IsZero() && l.rate == rate && l.burst == math.Max(float64(burst), 1) {
+		return
+	}
+
+	l.rate = rate
+	l.burst = math.Max(float64(burst), 1)
+	l.tokens = l.burst
+	l.last = time.Now()
+}
+
+// Unlimited reports whether the limiter allows everything
+func (l *Limiter) Unlimited() bool {
+	if l == nil {
+		return true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.rate <= 0
+}
+
+// Burst returns the most tokens taken at once
+func (l *Limiter) Burst() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return int(l.burst)
+}
+
+// refill adds the tokens earned since the last call
+func (l *Limiter) refill(now time.Time) {
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// Allow takes a token if one is available
+func (l *Limiter) Allow() bool {
+	if l == nil {
+		return true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.rate <= 0 {
+		return true
+	}
+
+	l.refill(time.Now())
+
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+
+	return true
+}
+
+// reserve takes n tokens, going into debt if there are not
+// enough, and returns how long to wait until they are earned
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// WaitN blocks until n tokens are taken or ctx is done
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	wait := l.reserve(n)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitAll takes n tokens from every limiter
+func waitAll(ctx context.Context, limiters []*Limiter, n int) error {
+	for _, l := range limiters {
+		if err := l.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chunkSize returns how many bytes to pass at once so no
+// limiter is asked for more than its burst
+func chunkSize(limiters []*Limiter, n int) int {
+	for _, l := range limiters {
+		if l.Unlimited() {
+			continue
+		}
+
+		n = min(n, l.Burst())
+	}
+
+	return n
+}
+
+// active returns the limiters that limit anything
+func active(limiters []*Limiter) []*Limiter {
+	var limited []*Limiter
+
+	for _, l := range limiters {
+		if l != nil {
+			limited = append(limited, l)
+		}
+	}
+
+	return limited
+}
+
+type writer struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []*Limiter
+}
+
+// NewWriter returns a writer passing to w no faster than every
+// limiter allows, one token per byte. Writes fail once ctx is done.
+func NewWriter(ctx context.Context, w io.Writer, limiters ...*Limiter) io.Writer {
+	return &writer{ctx: ctx, w: w, limiters: active(limiters)}
+}
+
+func (w *writer) Write(b []byte) (int, error) {
+	written := 0
+
+	for len(b) > 0 {
+		chunk := chunkSize(w.limiters, len(b))
+
+		if err := waitAll(w.ctx, w.limiters, chunk); err != nil {
+			return written, err
+		}
+
+		n, err := w.w.Write(b[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		b = b[chunk:]
+	}
+
+	return written, nil
+}
+
+type reader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*Limiter
+}
+
+// NewReader returns a reader reading from r no faster than every
+// limiter allows, one token per byte. Reads fail once ctx is done.
+func NewReader(ctx context.Context, r io.Reader, limiters ...*Limiter) io.Reader {
+	return &reader{ctx: ctx, r: r, limiters: active(limiters)}
+}
+
+func (r *reader) Read(b []byte) (int, error) {
+	b = b[:chunkSize(r.limiters, len(b))]
+
+	n, err := r.r.Read(b)
+
+	if n > 0 {
+		if waitErr := waitAll(r.ctx, r.limiters, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
+
+// Group holds a limiter per key, such as per visitor IP,
+// all sharing the same rate and burst
+type Group struct {
+	rate  float64
+	burst int
+
+	limiters  map[string]*groupLimiter
+	lastPrune time.Time
+	mutex     sync.Mutex
+}
+
+type groupLimiter struct {
+	*Limiter
+	lastUsed time.Time
+}
+
+// GROUP_IDLE is how long a limiter of a group is kept unused
+const GROUP_IDLE = 10 * time.Minute
+
+// GROUP_MAX_KEYS is how many limiters a group keeps. The least
+// recently used one is dropped to make room for another.
+const GROUP_MAX_KEYS = 4096
+
+// NewGroup returns a group of limiters allowing rate tokens per
+// second with bursts of up to burst tokens to each key
+func NewGroup(rate float64, burst int) *Group {
+	return &Group{
+		rate:      rate,
+		burst:     burst,
+		limiters:  make(map[string]*groupLimiter),
+		lastPrune: time.Now(),
+	}
+}
+
+// Get returns the limiter of key, or nil when the group
+// allows everything
+func (g *Group) Get(key string) *Limiter {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.rate <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	if now.Sub(g.lastPrune) > GROUP_IDLE {
+		g.prune(now)
+	}
+
+	l, ok := g.limiters[key]
+	if !ok {
+		if len(g.limiters) >= GROUP_MAX_KEYS {
+			g.evict()
+		}
+
+		l = &groupLimiter{Limiter: NewLimiter(g.rate, g.burst)}
+		g.limiters[key] = l
+	}
+
+	l.lastUsed = now
+
+	return l.Limiter
+}
+
+// Len returns how many limiters the group keeps
+func (g *Group) Len() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return len(g.limiters)
+}
+
+// prune drops the limiters unused for GROUP_IDLE
+func (g *Group) prune(now time.Time) {
+	for key, l := range g.limiters {
+		if now.Sub(l.lastUsed) > GROUP_IDLE {
+			delete(g.limiters, key)
+		}
+	}
+
+	g.lastPrune = now
+}
+
+// evict drops the least recently used limiter
+func (g *Group) evict() {
+	var (
+		oldest   string
+		lastUsed time.Time
+	)
+
+	for key, l := range g.limiters {
+		if lastUsed.IsZero() || l.lastUsed.Before(lastUsed) {
+			oldest = key
+			lastUsed = l.lastUsed
+		}
+	}
+
+	delete(g.limiters, oldest)
+}
+
+// SetLimit changes the rate and burst of every limiter of the group
+func (g *Group) SetLimit(rate float64, burst int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if rate == g.rate && burst == g.burst {
+		return
+	}
+
+	g.rate = rate
+	g.burst = burst
+
+	for _, l := range g.limiters {
+		l.SetLimit(rate, burst)
+	}
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		tries int
+		want  int
+	}{
+		{"unlimited", 0, 0, 100, 100},
+		{"burst", 1, 5, 10, 5},
+		{"burst of at least one", 1, 0, 3, 1},
+		{"negative rate", -1, 5, 10, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.rate, tt.burst)
+
+			allowed := 0
+			for i := 0; i < tt.tries; i++ {
+				if l.Allow() {
+					allowed++
+				}
+			}
+
+			if allowed != tt.want {
+				t.Errorf("allowed %v of %v, want %v", allowed, tt.tries, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *Limiter
+
+	if !l.Allow() || !l.Unlimited() || l.WaitN(context.Background(), 10) != nil {
+		t.Errorf("a nil limiter limits")
+	}
+}
+
+func TestLimiterWaitN(t *testing.T) {
+	l := NewLimiter(1000, 10)
+
+	start := time.Now()
+	if err := l.WaitN(context.Background(), 60); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 tokens are in the bucket and 50 are earned in 50ms
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("waited %v, want about 50ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := l.WaitN(ctx, 1000); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitN = %v, want context.Canceled", err)
+	}
+}
+
+func TestLimiterSetLimit(t *testing.T) {
+	l := NewLimiter(1, 1)
+	l.Allow()
+
+	// The same limits keep the tokens already taken
+	l.SetLimit(1, 1)
+	if l.Allow() {
+		t.Errorf("unchanged limits refilled the bucket")
+	}
+
+	l.SetLimit(0, 0)
+	if !l.Unlimited() || !l.Allow() {
+		t.Errorf("limiter still limits once unlimited")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	// 100 bytes in the bucket and 200 more earned in 20ms
+	w := NewWriter(context.Background(), &buf, NewLimiter(10000, 100), nil)
+
+	start := time.Now()
+	n, err := w.Write(make([]byte, 300))
+	if err != nil || n != 300 || buf.Len() != 300 {
+		t.Fatalf("Write = %v, %v with %v bytes written", n, err, buf.Len())
+	}
+
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("wrote in %v, want about 20ms", elapsed)
+	}
+}
+
+func TestReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := NewReader(ctx, bytes.NewReader(make([]byte, 100)), NewLimiter(1, 1))
+
+	// Reads are cut to the burst, and the first one is in the bucket
+	if n, err := r.Read(make([]byte, 100)); n != 1 || err != nil {
+		t.Fatalf("Read = %v, %v, want 1 byte", n, err)
+	}
+
+	if _, err := r.Read(make([]byte, 100)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read = %v, want context.Canceled", err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	g := NewGroup(1, 1)
+
+	if !g.Get("10.0.0.1").Allow() || g.Get("10.0.0.1").Allow() {
+		t.Errorf("a key is not limited to its burst")
+	}
+
+	if !g.Get("10.0.0.2").Allow() {
+		t.Errorf("keys share a limiter")
+	}
+
+	if NewGroup(0, 0).Get("10.0.0.1") != nil {
+		t.Errorf("an unlimited group returned a limiter")
+	}
+
+	for i := 0; i < GROUP_MAX_KEYS+10; i++ {
+		g.Get(fmt.Sprintf("key-%v", i))
+	}
+
+	if g.Len() != GROUP_MAX_KEYS {
+		t.Errorf("group keeps %v limiters, want %v", g.Len(), GROUP_MAX_KEYS)
+	}
+
+	g.SetLimit(0, 0)
+	if g.Get("10.0.0.1") != nil {
+		t.Errorf("group still limits once unlimited")
+	}
+}
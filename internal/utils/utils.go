@@ -3,14 +3,20 @@ package utils
 import (
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 )
 
 func ParseWsMessage(message []byte, identifier string) string {
-	if strings.Contains(string(message), identifier) {
-		return strings.Split(string(message), ": ")[1]
+	if strings.HasPrefix(string(message), identifier) {
+		parts := strings.SplitN(string(message), ": ", 2)
+		if len(parts) == 2 {
+			return parts[1]
+		}
 	}
 
 	return ""
@@ -28,15 +34,24 @@ func GetSNetTDir() (string, error) {
 	return path, nil
 }
 
-func GetLocalIp() ([]string, error) {
+// GetLocalIp returns the private IPv4 addresses followed by the
+// IPv6 unique local and link-local addresses of the machine.
+// Link-local addresses include their zone, such as fe80::1%eth0.
+// When interface names are given, only those interfaces are used.
+func GetLocalIp(ifaceNames ...string) ([]string, error) {
 	localIps := []string{}
+	localIpv6s := []string{}
 
-	ifs, err := net.Interfaces()
+	ifs, err := GetInterfaces(ifaceNames...)
 	if err != nil {
 		return localIps, err
 	}
 
 	for _, iface := range ifs {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+
 		addrs, err := iface.Addrs()
 		if err != nil {
 			continue
@@ -44,15 +59,55 @@ func GetLocalIp() ([]string, error) {
 
 		for _, addr := range addrs {
 			ip, ok := addr.(*net.IPNet)
-			if ok && !ip.IP.IsLoopback() && ip.IP.IsPrivate() {
-				v4 := ip.IP.To4()
-				if v4 != nil {
+			if !ok || ip.IP.IsLoopback() {
+				continue
+			}
+
+			if v4 := ip.IP.To4(); v4 != nil {
+				if v4.IsPrivate() {
 					localIps = append(localIps, v4.String())
 				}
+			} else if ip.IP.IsPrivate() {
+				localIpv6s = append(localIpv6s, ip.IP.String())
+			} else if ip.IP.IsLinkLocalUnicast() {
+				localIpv6s = append(localIpv6s, ip.IP.String()+"%"+iface.Name)
 			}
 		}
 	}
-	return localIps, nil
+
+	return append(localIps, localIpv6s...), nil
+}
+
+// GetInterfaces returns the named network interfaces,
+// or all of them when no names are given
+func GetInterfaces(ifaceNames ...string) ([]net.Interface, error) {
+	if len(ifaceNames) == 0 {
+		return net.Interfaces()
+	}
+
+	ifs := []net.Interface{}
+
+	for _, name := range ifaceNames {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return ifs, fmt.Errorf("unknown interface %q: %w", name, err)
+		}
+
+		ifs = append(ifs, *iface)
+	}
+
+	return ifs, nil
+}
+
+// HostURL returns the http URL of a server on ip and port,
+// bracketing IPv6 addresses and escaping their zone
+func HostURL(ip string, port int) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(ip, strconv.Itoa(port)),
+	}
+
+	return u.String()
 }
 
 func FmtBytes(bytes int64) string {
@@ -90,3 +145,17 @@ func StandardizeMimeType(mimeType string) string {
 
 	return mimeType
 }
+
+// HasDisplay reports whether notifications and the clipboard can
+// reach a user, which is not the case on headless servers or
+// in SSH sessions without a forwarded display
+func HasDisplay() bool {
+	switch runtime.GOOS {
+	case "windows":
+		return true
+	case "darwin":
+		return os.Getenv("SSH_CONNECTION") == "" && os.Getenv("SSH_TTY") == ""
+	}
+
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
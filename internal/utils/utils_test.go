@@ -0,0 +1,46 @@
+package utils
+
+import "testing"
+
+func TestParseWsMessage(t *testing.T) {
+	tests := []struct {
+		message    string
+		identifier string
+		want       string
+	}{
+		{"FILES: /docs", "FILES:", "/docs"},
+		{"CONNECT: abc", "CONNECT:", "abc"},
+		{`WORMHOLE_SHARE: {"files":["a: b"]}`, "WORMHOLE_SHARE:", `{"files":["a: b"]}`},
+		{"FILES: /docs", "CONNECT:", ""},
+		{"FILES:/docs", "FILES:", ""},
+		{"FILES: ", "FILES:", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			if got := ParseWsMessage([]byte(tt.message), tt.identifier); got != tt.want {
+				t.Errorf("ParseWsMessage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostURL(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.168.1.5", "http://192.168.1.5:9091"},
+		{"fd00::5", "http://[fd00::5]:9091"},
+		{"fe80::1%eth0", "http://[fe80::1%25eth0]:9091"},
+		{"localhost", "http://localhost:9091"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := HostURL(tt.ip, 9091); got != tt.want {
+				t.Errorf("HostURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,14 +1,16 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/Owbird/SNetT-Engine/internal/logger"
-	"github.com/Owbird/SNetT-Engine/internal/utils"
-	"github.com/Owbird/SNetT-Engine/pkg/models"
-	"github.com/atotto/clipboard"
-	"github.com/martinlindhe/notify"
 	"github.com/spf13/viper"
 )
 
@@ -17,22 +19,181 @@ type ServerConfig struct {
 	AllowUploads bool   `mapstructure:"allowUploads"`
 	AllowOnline  bool   `mapstructure:"allowOnline"`
 	Port         int    `mapstructure:"port"`
+
+	// Network interfaces to serve and advertise on. All when empty.
+	Interfaces []string `mapstructure:"interfaces"`
+
+	// Address to bind to, such as 0.0.0.0, :: or a single IP.
+	// All addresses of the chosen interfaces when empty.
+	Bind string `mapstructure:"bind"`
+
+	// What to do when the port is taken: none, next or random
+	PortFallback string `mapstructure:"portFallback"`
+
+	// Whether to serve Prometheus metrics on /metrics
+	Metrics bool `mapstructure:"metrics"`
+
+	// Whether uploads wait in quarantine until the host approves them
+	ApproveUploads bool `mapstructure:"approveUploads"`
+
+	// The bandwidth and request limits of the visitors
+	Limits *LimitConfig `mapstructure:"limits"`
 }
 
-type NotifConfig struct {
-	AllowNotif bool `mapstructure:"allowNotif"`
+type LimitConfig struct {
+	// Bandwidth shared by every download and upload in KiB/s.
+	// Unlimited when zero.
+	Bandwidth int `mapstructure:"bandwidth"`
+
+	// Bandwidth of each visitor IP in KiB/s. Unlimited when zero.
+	VisitorBandwidth int `mapstructure:"visitorBandwidth"`
+
+	// Downloads served at once. Unlimited when zero.
+	MaxDownloads int `mapstructure:"maxDownloads"`
+
+	// Directory listings each visitor may request per minute.
+	// Unlimited when zero.
+	FilesPerMinute int `mapstructure:"filesPerMinute"`
+}
+
+type SSHTunnelConfig struct {
+	// Address of the SSH server, host:port
+	Address string `mapstructure:"address"`
+
+	// User to log in as
+	User string `mapstructure:"user"`
+
+	// Private key to authenticate with. The SSH agent
+	// is used when empty.
+	KeyFile string `mapstructure:"keyFile"`
+
+	// known_hosts file used to verify the server
+	KnownHostsFile string `mapstructure:"knownHostsFile"`
+
+	// Address the server listens on for the tunnel
+	RemoteHost string `mapstructure:"remoteHost"`
+
+	// Port the server listens on for the tunnel
+	RemotePort int `mapstructure:"remotePort"`
+
+	// URL visitors use to reach the tunnel on the server
+	PublicURL string `mapstructure:"publicURL"`
+}
+
+type TunnelConfig struct {
+	// The tunnel provider: localtunnel, selfhosted or ssh
+	Provider string `mapstructure:"provider"`
+
+	// Base URL of a self-hosted localtunnel-compatible server
+	Host string `mapstructure:"host"`
+
+	// Subdomain to request from localtunnel servers
+	Subdomain string `mapstructure:"subdomain"`
+
+	// The SSH reverse tunnel configuration
+	SSH *SSHTunnelConfig `mapstructure:"ssh"`
+}
+
+type HookConfig struct {
+	// Events that fire the hook, such as upload_completed.
+	// Every event fires it when empty.
+	Events []string `mapstructure:"events"`
+
+	// URL to POST the event to as JSON
+	URL string `mapstructure:"url"`
+
+	// Secret to sign the webhook payload with
+	Secret string `mapstructure:"secret"`
+
+	// Command to run with the event details in its environment
+	Command string `mapstructure:"command"`
+
+	// How long a webhook request or command may take
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// How many times a failed webhook is retried
+	Retries int `mapstructure:"retries"`
+}
+
+type LogConfig struct {
+	// Minimum level to log: debug, info, warn or error
+	Level string `mapstructure:"level"`
+
+	// Format of the log lines: text or json
+	Format string `mapstructure:"format"`
+
+	// Where to log: stdout, stderr and/or file
+	Destinations []string `mapstructure:"destinations"`
+
+	// Only log errors to the console
+	Quiet bool `mapstructure:"quiet"`
+
+	// Size in megabytes a log file grows to before it is rotated
+	MaxSize int `mapstructure:"maxSize"`
+
+	// Days to keep rotated log files
+	MaxAge int `mapstructure:"maxAge"`
+
+	// How many rotated log files to keep
+	MaxBackups int `mapstructure:"maxBackups"`
+
+	// Whether to gzip rotated log files
+	Compress bool `mapstructure:"compress"`
+
+	// Whether to write HTTP requests to logs/access.log
+	AccessLog bool `mapstructure:"accessLog"`
+
+	// Format of the access log: combined or json
+	AccessLogFormat string `mapstructure:"accessLogFormat"`
+}
+
+// Options returns the application logger options
+func (lc *LogConfig) Options() logger.Options {
+	if lc == nil {
+		return logger.DefaultOptions
+	}
+
+	return logger.Options{
+		Level:        lc.Level,
+		Format:       lc.Format,
+		Destinations: lc.Destinations,
+		Quiet:        lc.Quiet,
+		Rotate:       lc.Rotation(),
+	}
 }
 
-func (nc *NotifConfig) SendNotification(notification models.Notification) {
-	if nc.AllowNotif {
-		notify.Notify("SNetT", notification.Title, notification.Body, "")
+// Rotation returns how the log files are rotated
+func (lc *LogConfig) Rotation() logger.RotateConfig {
+	if lc == nil {
+		return logger.DefaultRotateConfig
 	}
 
-	if notification.ClipboardText != "" {
-		clipboard.WriteAll(notification.ClipboardText)
+	return logger.RotateConfig{
+		MaxSize:    lc.MaxSize,
+		MaxAge:     lc.MaxAge,
+		MaxBackups: lc.MaxBackups,
+		Compress:   lc.Compress,
 	}
 }
 
+type NotifConfig struct {
+	AllowNotif bool `mapstructure:"allowNotif"`
+
+	// Notifiers that show the notifications: auto,
+	// desktop, dbus, log, push and/or none
+	Notifiers []string `mapstructure:"notifiers"`
+
+	// The ntfy or Gotify endpoint of the push notifier
+	Push *PushConfig `mapstructure:"push"`
+
+	// When to copy share codes and URLs to the
+	// clipboard: auto (with a display), always or never
+	Clipboard string `mapstructure:"clipboard"`
+
+	// Notifier used in place of the configured ones when set
+	Custom Notifier `mapstructure:"-"`
+}
+
 // AppConfig holds the server configuration
 type AppConfig struct {
 	// The server configuration
@@ -40,54 +201,208 @@ type AppConfig struct {
 
 	// The notification configuration
 	Notification *NotifConfig `mapstructure:"notification"`
+
+	// The online access tunnel configuration
+	Tunnel *TunnelConfig `mapstructure:"tunnel"`
+
+	// The webhooks and commands to run on server events
+	Hooks []HookConfig `mapstructure:"hooks"`
+
+	// The log files configuration
+	Log *LogConfig `mapstructure:"log"`
+
+	// The profile applied over the server and notification settings
+	Profile string `mapstructure:"profile"`
+
+	// The named profiles, each overriding some of the
+	// server and notification settings
+	Profiles map[string]map[string]any `mapstructure:"profiles"`
+
+	// The settings the configuration was decoded from
+	v *viper.Viper
+
+	// The snett.toml the configuration is saved to
+	path string
+
+	// Whether the profile and SNETT_* environment
+	// variables override the file
+	overrides bool
+
+	// The profile chosen in place of the one in the file
+	profile string
 }
 
-// Gets the app configuration from
-// snet.toml with default values
-// if absent
-func NewAppConfig() *AppConfig {
-	userDir, err := utils.GetSNetTDir()
-	if err != nil {
-		logger.Logger.Error("Failed to get user dir", "err", err)
-		os.Exit(1)
+// ENV_PREFIX prefixes the environment variables that override
+// settings, such as SNETT_SERVER_PORT for server.port
+const ENV_PREFIX = "SNETT"
+
+// Load reads the app configuration from the snett.toml at path,
+// or ~/.snett/snett.toml when path is empty. Settings absent from
+// the file, or a missing file, take their default values. The
+// active profile and SNETT_* environment variables override
+// both, in that order. Nothing is written; use Save to create
+// the file.
+func Load(path string) (*AppConfig, error) {
+	return load(path, true, "")
+}
+
+// LoadProfile reads the app configuration like Load, applying the
+// named profile in place of the one chosen in the file
+func LoadProfile(path string, profile string) (*AppConfig, error) {
+	return load(path, true, profile)
+}
+
+// LoadFile reads the app configuration like Load, without the
+// profile and environment overrides, so that saving it only
+// keeps the settings from the file
+func LoadFile(path string) (*AppConfig, error) {
+	return load(path, false, "")
+}
+
+func load(path string, overrides bool, profile string) (*AppConfig, error) {
+	if path == "" {
+		defaultPath, err := DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+		path = defaultPath
 	}
 
-	viper.SetConfigName("snett")
-	viper.SetConfigType("toml")
+	v := newViper()
+	v.SetConfigFile(path)
 
-	viper.AddConfigPath(userDir)
+	if overrides {
+		v.SetEnvPrefix(ENV_PREFIX)
+		v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+		v.AutomaticEnv()
+	}
 
-	hostname, err := os.Hostname()
+	err := v.ReadInConfig()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %v: %w", path, err)
+	}
+
+	active := profile
+
+	if overrides {
+		if active == "" {
+			active = v.GetString("profile")
+		}
+
+		if err := applyProfile(v, active); err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := decode(v, path)
 	if err != nil {
-		logger.Logger.Error("Failed to get hostname", "err", err)
-		os.Exit(1)
+		return nil, err
 	}
 
-	viper.SetDefault("server.name", fmt.Sprintf("%v's Server", hostname))
-	viper.SetDefault("server.allowUploads", false)
-	viper.SetDefault("server.allowOnline", false)
-	viper.SetDefault("server.port", 9091)
-	viper.SetDefault("notification.allowNotif", false)
+	if overrides {
+		config.Profile = active
+	}
+
+	config.overrides = overrides
+	config.profile = profile
+
+	return config, nil
+}
+
+// Default returns the default app configuration without reading
+// any file or environment variable. Save writes it to
+// ~/.snett/snett.toml.
+func Default() *AppConfig {
+	config, _ := decode(newViper(), "")
 
-	err = viper.ReadInConfig()
+	return config
+}
+
+// DefaultPath returns the path of ~/.snett/snett.toml
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			viper.SafeWriteConfig()
-		} else {
-			logger.Logger.Error("Error reading config file", "err", err)
-			os.Exit(1)
-		}
+		return "", err
 	}
 
+	return filepath.Join(homeDir, ".snett", "snett.toml"), nil
+}
+
+func decode(v *viper.Viper, path string) (*AppConfig, error) {
 	var config AppConfig
 
-	err = viper.Unmarshal(&config)
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+
+	config.v = v
+	config.path = path
+
+	return &config, nil
+}
+
+// newViper returns a viper instance with the default values
+func newViper() *viper.Viper {
+	v := viper.New()
+
+	v.SetConfigType("toml")
+
+	hostname, err := os.Hostname()
 	if err != nil {
-		logger.Logger.Error("unable to decode into struct", "err", err)
-		os.Exit(1)
+		hostname = "SNetT"
 	}
 
-	return &config
+	v.SetDefault("server.name", fmt.Sprintf("%v's Server", hostname))
+	v.SetDefault("server.allowUploads", false)
+	v.SetDefault("server.allowOnline", false)
+	v.SetDefault("server.port", 9091)
+	v.SetDefault("server.interfaces", []string{})
+	v.SetDefault("server.bind", "")
+	v.SetDefault("server.portFallback", "none")
+	v.SetDefault("server.metrics", false)
+	v.SetDefault("server.approveUploads", false)
+	v.SetDefault("server.limits.bandwidth", 0)
+	v.SetDefault("server.limits.visitorBandwidth", 0)
+	v.SetDefault("server.limits.maxDownloads", 0)
+	v.SetDefault("server.limits.filesPerMinute", 0)
+	v.SetDefault("notification.allowNotif", false)
+	v.SetDefault("notification.notifiers", []string{NOTIFIER_AUTO})
+	v.SetDefault("notification.clipboard", CLIPBOARD_AUTO)
+	v.SetDefault("notification.push.service", PUSH_NTFY)
+	v.SetDefault("notification.push.url", "")
+	v.SetDefault("notification.push.topic", "")
+	v.SetDefault("notification.push.token", "")
+	v.SetDefault("notification.push.priority", 0)
+	v.SetDefault("notification.push.timeout", DEFAULT_PUSH_TIMEOUT)
+	v.SetDefault("notification.push.includeCodes", false)
+	v.SetDefault("tunnel.provider", "localtunnel")
+	v.SetDefault("tunnel.host", "")
+	v.SetDefault("tunnel.subdomain", "")
+	v.SetDefault("tunnel.ssh.address", "")
+	v.SetDefault("tunnel.ssh.user", "")
+	v.SetDefault("tunnel.ssh.keyFile", "")
+	v.SetDefault("tunnel.ssh.knownHostsFile", "")
+	v.SetDefault("tunnel.ssh.remoteHost", "localhost")
+	v.SetDefault("tunnel.ssh.remotePort", 8080)
+	v.SetDefault("tunnel.ssh.publicURL", "")
+	v.SetDefault("log.level", logger.DefaultOptions.Level)
+	v.SetDefault("log.format", logger.DefaultOptions.Format)
+	v.SetDefault("log.destinations", logger.DefaultOptions.Destinations)
+	v.SetDefault("log.quiet", false)
+	v.SetDefault("log.maxSize", logger.DefaultRotateConfig.MaxSize)
+	v.SetDefault("log.maxAge", logger.DefaultRotateConfig.MaxAge)
+	v.SetDefault("log.maxBackups", logger.DefaultRotateConfig.MaxBackups)
+	v.SetDefault("log.compress", logger.DefaultRotateConfig.Compress)
+	v.SetDefault("log.accessLog", false)
+	v.SetDefault("log.accessLogFormat", "combined")
+	v.SetDefault("profile", "")
+
+	return v
+}
+
+// Path returns the file the configuration is loaded from and saved to
+func (ac *AppConfig) Path() string {
+	return ac.path
 }
 
 // GetSeverConfig returns the server configuration
@@ -100,10 +415,108 @@ func (ac *AppConfig) GetNotifConfig() *NotifConfig {
 	return ac.Notification
 }
 
-// Save saves the server configuration to snet.toml
+// GetTunnelConfig returns the tunnel configuration
+func (ac *AppConfig) GetTunnelConfig() *TunnelConfig {
+	return ac.Tunnel
+}
+
+// GetHooksConfig returns the hooks configuration
+func (ac *AppConfig) GetHooksConfig() []HookConfig {
+	return ac.Hooks
+}
+
+// GetLogConfig returns the log files configuration
+func (ac *AppConfig) GetLogConfig() *LogConfig {
+	return ac.Log
+}
+
+// Save saves the configuration to its snett.toml,
+// or ~/.snett/snett.toml for the default configuration
 func (ac *AppConfig) Save() error {
-	viper.Set("server", ac.Server)
-	viper.Set("notification", ac.Notification)
+	if ac.path == "" {
+		path, err := DefaultPath()
+		if err != nil {
+			return err
+		}
+		ac.path = path
+	}
+
+	if ac.v == nil {
+		ac.v = newViper()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ac.path), 0755); err != nil {
+		return err
+	}
+
+	ac.v.Set("server", toSettings(ac.Server))
+	ac.v.Set("notification", toSettings(ac.Notification))
+	ac.v.Set("tunnel", toSettings(ac.Tunnel))
+	ac.v.Set("hooks", toSettings(ac.Hooks))
+	ac.v.Set("log", toSettings(ac.Log))
+	ac.v.Set("profile", ac.Profile)
+	ac.v.Set("profiles", toSettings(ac.Profiles))
+
+	return ac.v.WriteConfigAs(ac.path)
+}
+
+// toSettings converts a configuration value to maps keyed by the
+// mapstructure tags, so it is saved with the same keys it is read with
+func toSettings(value any) any {
+	return settingsOf(reflect.ValueOf(value))
+}
+
+func settingsOf(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return settingsOf(v.Elem())
+
+	case reflect.Struct:
+		settings := map[string]any{}
+
+		for i := 0; i < v.NumField(); i++ {
+			key := v.Type().Field(i).Tag.Get("mapstructure")
+			if key == "" || key == "-" {
+				continue
+			}
+
+			if value := settingsOf(v.Field(i)); value != nil {
+				settings[key] = value
+			}
+		}
+
+		return settings
+
+	case reflect.Map:
+		settings := map[string]any{}
+
+		for _, key := range v.MapKeys() {
+			if value := settingsOf(v.MapIndex(key)); value != nil {
+				settings[fmt.Sprint(key.Interface())] = value
+			}
+		}
+
+		return settings
+
+	case reflect.Slice:
+		settings := make([]any, v.Len())
+		for i := range settings {
+			settings[i] = settingsOf(v.Index(i))
+		}
+
+		return settings
+	}
 
-	return viper.WriteConfig()
+	return v.Interface()
 }
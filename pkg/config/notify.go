@@ -0,0 +1,281 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/Owbird/SNetT-Engine/internal/logger"
+	"github.com/Owbird/SNetT-Engine/internal/utils"
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+	"github.com/atotto/clipboard"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// Notifiers
+	NOTIFIER_AUTO    = "auto"
+	NOTIFIER_DESKTOP = "desktop"
+	NOTIFIER_DBUS    = "dbus"
+	NOTIFIER_LOG     = "log"
+	NOTIFIER_PUSH    = "push"
+	NOTIFIER_NONE    = "none"
+)
+
+const (
+	// Clipboard policies
+	CLIPBOARD_AUTO   = "auto"
+	CLIPBOARD_ALWAYS = "always"
+	CLIPBOARD_NEVER  = "never"
+)
+
+// NOTIF_APP_NAME is the application the notifications are shown for
+const NOTIF_APP_NAME = "SNetT"
+
+// Notifier shows notifications to the host
+type Notifier interface {
+	Notify(notification models.Notification) error
+}
+
+// ErrNoDesktopNotifier is returned when the tool used to show
+// desktop notifications is not installed
+var ErrNoDesktopNotifier = errors.New("no desktop notification tool found")
+
+// The PowerShell script showing a toast on Windows. The text is
+// read from the environment so that it is never parsed as code.
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName("text")
+$text.Item(0).AppendChild($template.CreateTextNode($env:SNETT_NOTIF_TITLE)) > $null
+$text.Item(1).AppendChild($template.CreateTextNode($env:SNETT_NOTIF_BODY)) > $null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe').Show($toast)`
+
+// DesktopNotifier shows notifications with the tools of the
+// operating system: notify-send on Linux and the BSDs, osascript
+// on macOS and a PowerShell toast on Windows
+type DesktopNotifier struct{}
+
+func (n DesktopNotifier) Notify(notification models.Notification) error {
+	cmd, err := desktopCommand(notification)
+	if err != nil {
+		return err
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v failed: %w: %v", cmd.Args[0], err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// desktopCommand returns the command showing notification on this
+// operating system, or ErrNoDesktopNotifier if its tool is missing
+func desktopCommand(notification models.Notification) (*exec.Cmd, error) {
+	var (
+		name string
+		args []string
+	)
+
+	switch runtime.GOOS {
+	case "darwin":
+		// The text is passed as arguments rather than in the script
+		name = "osascript"
+		args = []string{
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			notification.Title, notification.Body,
+		}
+
+	case "windows":
+		name = "powershell"
+		args = []string{"-NoProfile", "-NonInteractive", "-Command", toastScript}
+
+	default:
+		name = "notify-send"
+		args = []string{"--app-name", NOTIF_APP_NAME, "--", notification.Title, notification.Body}
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v is not installed", ErrNoDesktopNotifier, name)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Env = append(os.Environ(),
+		"SNETT_NOTIF_TITLE="+notification.Title,
+		"SNETT_NOTIF_BODY="+notification.Body,
+	)
+
+	return cmd, nil
+}
+
+// NopNotifier drops every notification
+type NopNotifier struct{}
+
+func (n NopNotifier) Notify(notification models.Notification) error {
+	return nil
+}
+
+// LogNotifier writes notifications to a logger, such
+// as on headless servers
+type LogNotifier struct {
+	// The logger to write to. The application logger when nil.
+	Logger *slog.Logger
+}
+
+func (n LogNotifier) Notify(notification models.Notification) error {
+	log := n.Logger
+	if log == nil {
+		log = logger.Logger
+	}
+
+	log.Info("Notification", "title", notification.Title, "body", notification.Body)
+
+	return nil
+}
+
+// DBusNotifier shows notifications through the
+// org.freedesktop.Notifications service of the session bus
+type DBusNotifier struct {
+	// How long the notification is shown in milliseconds.
+	// Zero or less uses the server default.
+	Timeout int32
+}
+
+func (n DBusNotifier) Notify(notification models.Notification) error {
+	conn, err := dbus.SessionBusPrivate()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Auth(nil); err != nil {
+		return err
+	}
+
+	if err := conn.Hello(); err != nil {
+		return err
+	}
+
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = -1
+	}
+
+	obj := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
+
+	return obj.Call(
+		"org.freedesktop.Notifications.Notify",
+		0,
+		NOTIF_APP_NAME,
+		uint32(0),
+		"",
+		notification.Title,
+		notification.Body,
+		[]string{},
+		map[string]dbus.Variant{},
+		timeout,
+	).Err
+}
+
+// multiNotifier sends notifications to several notifiers
+type multiNotifier []Notifier
+
+func (n multiNotifier) Notify(notification models.Notification) error {
+	var errs []error
+
+	for _, notifier := range n {
+		if err := notifier.Notify(notification); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewNotifier returns the notifier with the given name, other
+// than push, which needs a PushConfig. auto picks D-Bus or the
+// desktop notifier, or logs the notifications when there is
+// no display.
+func NewNotifier(name string) Notifier {
+	switch name {
+	case NOTIFIER_DESKTOP:
+		return DesktopNotifier{}
+	case NOTIFIER_DBUS:
+		return DBusNotifier{}
+	case NOTIFIER_LOG:
+		return LogNotifier{}
+	case NOTIFIER_NONE:
+		return NopNotifier{}
+	}
+
+	if !utils.HasDisplay() {
+		return LogNotifier{}
+	}
+
+	if runtime.GOOS == "linux" && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" {
+		return DBusNotifier{}
+	}
+
+	return DesktopNotifier{}
+}
+
+// Notifier returns the notifier that shows the notifications:
+// Custom when set, otherwise the configured notifiers
+func (nc *NotifConfig) Notifier() Notifier {
+	if nc.Custom != nil {
+		return nc.Custom
+	}
+
+	notifiers := multiNotifier{}
+	for _, name := range nc.Notifiers {
+		if name == NOTIFIER_PUSH {
+			notifiers = append(notifiers, NewPushNotifier(nc.Push))
+			continue
+		}
+
+		notifiers = append(notifiers, NewNotifier(name))
+	}
+
+	if len(notifiers) == 1 {
+		return notifiers[0]
+	}
+
+	return notifiers
+}
+
+// copyToClipboard reports whether the clipboard policy
+// allows copying to the clipboard
+func (nc *NotifConfig) copyToClipboard() bool {
+	switch nc.Clipboard {
+	case CLIPBOARD_ALWAYS:
+		return true
+	case CLIPBOARD_NEVER:
+		return false
+	}
+
+	return utils.HasDisplay()
+}
+
+// SendNotification shows the notification when notifications are
+// allowed, and copies its ClipboardText as the clipboard policy allows.
+// Failures to do either are reported to log.
+func (nc *NotifConfig) SendNotification(log *slog.Logger, notification models.Notification) {
+	if nc.AllowNotif {
+		if err := nc.Notifier().Notify(notification); err != nil {
+			log.Warn("Failed to send notification", "title", notification.Title, "err", err)
+		}
+	}
+
+	if notification.ClipboardText != "" && nc.copyToClipboard() {
+		if err := clipboard.WriteAll(notification.ClipboardText); err != nil {
+			log.Warn("Failed to copy to clipboard", "err", err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+)
+
+func TestDesktopNotifier(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("uses a fake notify-send")
+	}
+
+	bin := t.TempDir()
+	out := filepath.Join(bin, "args")
+
+	fake := func(script string) {
+		os.WriteFile(filepath.Join(bin, "notify-send"), []byte("#!/bin/sh\n"+script), 0755)
+	}
+
+	t.Setenv("PATH", bin)
+
+	notification := models.Notification{Title: "SNetT", Body: "-r 'quoted' $HOME"}
+
+	fake(`printf '%s\n' "$@" > ` + out)
+	if err := (DesktopNotifier{}).Notify(notification); err != nil {
+		t.Fatal(err)
+	}
+
+	args, _ := os.ReadFile(out)
+	if want := "--app-name\nSNetT\n--\nSNetT\n-r 'quoted' $HOME\n"; string(args) != want {
+		t.Errorf("args = %q, want %q", args, want)
+	}
+
+	fake("echo 'no daemon' >&2; exit 1")
+	if err := (DesktopNotifier{}).Notify(notification); err == nil || !strings.Contains(err.Error(), "no daemon") {
+		t.Errorf("Notify = %v, want the tool's error", err)
+	}
+
+	os.Remove(filepath.Join(bin, "notify-send"))
+	if err := (DesktopNotifier{}).Notify(notification); !errors.Is(err, ErrNoDesktopNotifier) {
+		t.Errorf("Notify = %v, want ErrNoDesktopNotifier", err)
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// profileSections are the sections a profile can override
+var profileSections = []struct {
+	name     string
+	settings reflect.Type
+}{
+	{"server", reflect.TypeFor[ServerConfig]()},
+	{"notification", reflect.TypeFor[NotifConfig]()},
+}
+
+// profileSetting returns the full name of a profile setting,
+// such as server.allowUploads for allowUploads
+func profileSetting(key string) (string, bool) {
+	for _, section := range profileSections {
+		for i := 0; i < section.settings.NumField(); i++ {
+			tag := section.settings.Field(i).Tag.Get("mapstructure")
+			if strings.EqualFold(tag, key) {
+				return section.name + "." + tag, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// applyProfile merges the settings of the named
+// profile over the server and notification settings
+func applyProfile(v *viper.Viper, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	overrides := map[string]any{}
+
+	for key, value := range v.GetStringMap("profiles." + name) {
+		setting, ok := profileSetting(key)
+		if !ok {
+			continue
+		}
+
+		section, field, _ := strings.Cut(setting, ".")
+
+		settings, ok := overrides[section].(map[string]any)
+		if !ok {
+			settings = map[string]any{}
+			overrides[section] = settings
+		}
+
+		settings[field] = value
+	}
+
+	return v.MergeConfigMap(overrides)
+}
+
+// ProfileNames returns the names of the profiles in order
+func (ac *AppConfig) ProfileNames() []string {
+	return slices.Sorted(maps.Keys(ac.Profiles))
+}
+
+// CreateProfile adds a profile overriding the given server and
+// notification settings, such as allowUploads, parsed as the
+// type of the setting they override
+func (ac *AppConfig) CreateProfile(name string, settings map[string]string) error {
+	if name == "" || strings.ContainsAny(name, ". ") {
+		return fmt.Errorf("invalid profile name %q", name)
+	}
+
+	for existing := range ac.Profiles {
+		if strings.EqualFold(existing, name) {
+			return fmt.Errorf("profile %q already exists", name)
+		}
+	}
+
+	current := ac.Settings()
+	profile := map[string]any{}
+
+	for key, value := range settings {
+		setting, ok := profileSetting(key)
+		if !ok {
+			return fmt.Errorf("%v: profiles can only set server and notification settings", key)
+		}
+
+		parsed, err := parseSetting(setting, current[setting], value)
+		if err != nil {
+			return err
+		}
+
+		_, field, _ := strings.Cut(setting, ".")
+		profile[field] = parsed
+	}
+
+	return ac.apply("profiles."+name, profile)
+}
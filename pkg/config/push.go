@@ -0,0 +1,149 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+)
+
+const (
+	// Push notification services
+	PUSH_NTFY   = "ntfy"
+	PUSH_GOTIFY = "gotify"
+)
+
+// DEFAULT_PUSH_TIMEOUT is how long a push notification may take
+const DEFAULT_PUSH_TIMEOUT = 10 * time.Second
+
+type PushConfig struct {
+	// The service the endpoint speaks: ntfy or gotify
+	Service string `mapstructure:"service"`
+
+	// Base URL of the server, such as https://ntfy.sh
+	URL string `mapstructure:"url"`
+
+	// Topic to publish to on ntfy
+	Topic string `mapstructure:"topic"`
+
+	// Access token, or the application token on Gotify
+	Token string `mapstructure:"token"`
+
+	// Priority of the notifications, 1 to 5 on ntfy and
+	// 0 to 10 on Gotify. The server default when zero.
+	Priority int `mapstructure:"priority"`
+
+	// How long a notification may take to send
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// Whether to add the share codes and URLs meant for the
+	// clipboard to the message. Off by default, as anyone
+	// reading the topic could use them.
+	IncludeCodes bool `mapstructure:"includeCodes"`
+}
+
+// PushNotifier posts notifications to an ntfy or Gotify
+// compatible server, such as to reach a phone
+type PushNotifier struct {
+	// The push endpoint configuration
+	Config *PushConfig
+
+	// The client used to send the notifications.
+	// One with the configured timeout when nil.
+	Client *http.Client
+}
+
+// NewPushNotifier returns a push notifier for pushConfig
+func NewPushNotifier(pushConfig *PushConfig) *PushNotifier {
+	return &PushNotifier{
+		Config: pushConfig,
+	}
+}
+
+func (n *PushNotifier) Notify(notification models.Notification) error {
+	if n.Config == nil || n.Config.URL == "" {
+		return fmt.Errorf("no push notification url configured")
+	}
+
+	message := notification.Body
+	if n.Config.IncludeCodes && notification.ClipboardText != "" {
+		message = fmt.Sprintf("%v\n%v", message, notification.ClipboardText)
+	}
+
+	var (
+		endpoint string
+		payload  map[string]any
+	)
+
+	base := strings.TrimSuffix(n.Config.URL, "/")
+
+	switch n.Config.Service {
+	case PUSH_GOTIFY:
+		endpoint = base + "/message"
+		payload = map[string]any{
+			"title":   notification.Title,
+			"message": message,
+		}
+
+	default:
+		endpoint = base
+		payload = map[string]any{
+			"topic":   n.Config.Topic,
+			"title":   notification.Title,
+			"message": message,
+		}
+	}
+
+	if n.Config.Priority != 0 {
+		payload["priority"] = n.Config.Priority
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if n.Config.Token != "" {
+		if n.Config.Service == PUSH_GOTIFY {
+			req.Header.Set("X-Gotify-Key", n.Config.Token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+n.Config.Token)
+		}
+	}
+
+	client := n.Client
+	if client == nil {
+		timeout := n.Config.Timeout
+		if timeout <= 0 {
+			timeout = DEFAULT_PUSH_TIMEOUT
+		}
+
+		client = &http.Client{Timeout: timeout}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		reason, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+		return fmt.Errorf("push notification failed with status %v: %v", res.Status, strings.TrimSpace(string(reason)))
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+)
+
+func TestPushNotifier(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       PushConfig
+		wantPath     string
+		wantHeader   string
+		wantToken    string
+		wantMessage  string
+		wantTopic    string
+		wantPriority float64
+	}{
+		{
+			name:         "ntfy",
+			config:       PushConfig{Service: PUSH_NTFY, Topic: "snett", Token: "tk", Priority: 4},
+			wantPath:     "/",
+			wantHeader:   "Authorization",
+			wantToken:    "Bearer tk",
+			wantMessage:  "Share ready",
+			wantTopic:    "snett",
+			wantPriority: 4,
+		},
+		{
+			name:        "gotify",
+			config:      PushConfig{Service: PUSH_GOTIFY, Token: "app"},
+			wantPath:    "/message",
+			wantHeader:  "X-Gotify-Key",
+			wantToken:   "app",
+			wantMessage: "Share ready",
+		},
+		{
+			name:        "codes included",
+			config:      PushConfig{Service: PUSH_NTFY, Topic: "snett", IncludeCodes: true},
+			wantPath:    "/",
+			wantMessage: "Share ready\n7-crossword-puzzle",
+			wantTopic:   "snett",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]any
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.wantPath {
+					t.Errorf("path = %q, want %q", r.URL.Path, tt.wantPath)
+				}
+
+				if tt.wantHeader != "" && r.Header.Get(tt.wantHeader) != tt.wantToken {
+					t.Errorf("%v = %q, want %q", tt.wantHeader, r.Header.Get(tt.wantHeader), tt.wantToken)
+				}
+
+				json.NewDecoder(r.Body).Decode(&payload)
+			}))
+			defer srv.Close()
+
+			pushConfig := tt.config
+			pushConfig.URL = srv.URL + "/"
+
+			err := NewPushNotifier(&pushConfig).Notify(models.Notification{
+				Title:         "SNetT",
+				Body:          "Share ready",
+				ClipboardText: "7-crossword-puzzle",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if payload["message"] != tt.wantMessage {
+				t.Errorf("message = %q, want %q", payload["message"], tt.wantMessage)
+			}
+
+			if tt.wantTopic != "" && payload["topic"] != tt.wantTopic {
+				t.Errorf("topic = %v, want %v", payload["topic"], tt.wantTopic)
+			}
+
+			if priority, _ := payload["priority"].(float64); priority != tt.wantPriority {
+				t.Errorf("priority = %v, want %v", priority, tt.wantPriority)
+			}
+		})
+	}
+}
+
+func TestPushNotifierFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "topic not allowed", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	err := NewPushNotifier(&PushConfig{Service: PUSH_NTFY, URL: srv.URL, Topic: "snett"}).Notify(models.Notification{Body: "Hi"})
+	if err == nil {
+		t.Fatal("Notify succeeded, want the server's error")
+	}
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Settings returns every setting keyed by its dotted name,
+// such as server.port. Hooks are kept as a single list.
+func (ac *AppConfig) Settings() map[string]any {
+	settings := map[string]any{}
+
+	flatten(settings, "", ac.sections())
+
+	return settings
+}
+
+// Keys returns the setting names in order
+func (ac *AppConfig) Keys() []string {
+	return slices.Sorted(maps.Keys(ac.Settings()))
+}
+
+// Get returns the value of the setting key
+func (ac *AppConfig) Get(key string) (any, error) {
+	key, err := ac.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ac.Settings()[key], nil
+}
+
+// Set parses value as the type of the setting key and applies
+// it, leaving the configuration unchanged if the result is
+// invalid. Lists are given as comma separated values.
+func (ac *AppConfig) Set(key string, value string) error {
+	key, err := ac.lookup(key)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := parseSetting(key, ac.Settings()[key], value)
+	if err != nil {
+		return err
+	}
+
+	return ac.apply(key, parsed)
+}
+
+// Reset sets key back to its default value, or every
+// setting when key is empty
+func (ac *AppConfig) Reset(key string) error {
+	defaults := Default()
+
+	// The profiles are kept, as they have no defaults
+	if key == "" {
+		defaults.Profiles = ac.Profiles
+		ac.replace(defaults)
+
+		return nil
+	}
+
+	key, err := ac.lookup(key)
+	if err != nil {
+		return err
+	}
+
+	value, ok := defaults.Settings()[key]
+	if !ok {
+		return fmt.Errorf("%v: has no default value", key)
+	}
+
+	return ac.apply(key, value)
+}
+
+// Changed returns the names of the settings that
+// differ between ac and other, in order
+func (ac *AppConfig) Changed(other *AppConfig) []string {
+	settings := ac.Settings()
+	otherSettings := other.Settings()
+
+	keys := slices.Collect(maps.Keys(settings))
+	for key := range otherSettings {
+		if _, ok := settings[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	var changed []string
+
+	for _, key := range keys {
+		if !reflect.DeepEqual(settings[key], otherSettings[key]) {
+			changed = append(changed, key)
+		}
+	}
+
+	return changed
+}
+
+// lookup returns the name of the setting matching key,
+// which is compared case insensitively
+func (ac *AppConfig) lookup(key string) (string, error) {
+	for _, name := range ac.Keys() {
+		if strings.EqualFold(name, key) {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown setting %q", key)
+}
+
+// apply sets key to value and decodes the result into ac
+func (ac *AppConfig) apply(key string, value any) error {
+	sections := ac.sections()
+
+	parts := strings.Split(key, ".")
+	section := sections
+
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := section[part].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			section[part] = next
+		}
+
+		section = next
+	}
+
+	section[parts[len(parts)-1]] = value
+
+	v := viper.New()
+	if err := v.MergeConfigMap(sections); err != nil {
+		return err
+	}
+
+	updated, err := decode(v, ac.path)
+	if err != nil {
+		return err
+	}
+
+	// Settings that were already invalid are left for later
+	// calls to fix, so only the problems this change adds count
+	existing := map[string]bool{}
+	for _, err := range ac.problems() {
+		existing[err.Error()] = true
+	}
+
+	var errs []error
+	for _, err := range updated.problems() {
+		if !existing[err.Error()] {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+
+	ac.replace(updated)
+
+	return nil
+}
+
+// replace copies the settings of other into ac
+func (ac *AppConfig) replace(other *AppConfig) {
+	ac.Server = other.Server
+	ac.Notification = other.Notification
+	ac.Tunnel = other.Tunnel
+	ac.Hooks = other.Hooks
+	ac.Log = other.Log
+	ac.Profile = other.Profile
+	ac.Profiles = other.Profiles
+}
+
+// sections returns the configuration as maps keyed by
+// the mapstructure tags
+func (ac *AppConfig) sections() map[string]any {
+	sections, _ := toSettings(ac).(map[string]any)
+
+	return sections
+}
+
+func flatten(settings map[string]any, prefix string, section map[string]any) {
+	for key, value := range section {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if nested, ok := value.(map[string]any); ok {
+			flatten(settings, key, nested)
+			continue
+		}
+
+		settings[key] = value
+	}
+}
+
+// parseSetting parses value as the type of current
+func parseSetting(key string, current any, value string) (any, error) {
+	switch current := current.(type) {
+	case bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%v: must be true or false, got %q", key, value)
+		}
+		return parsed, nil
+
+	case int:
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%v: must be a number, got %q", key, value)
+		}
+		return parsed, nil
+
+	case string:
+		return value, nil
+
+	case []any:
+		if key == "hooks" {
+			return nil, fmt.Errorf("%v: can only be changed in snett.toml", key)
+		}
+
+		for _, item := range current {
+			if _, ok := item.(string); !ok {
+				return nil, fmt.Errorf("%v: can only be changed in snett.toml", key)
+			}
+		}
+
+		values := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("%v: can only be changed in snett.toml", key)
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   string
+		want    any
+		wantErr bool
+	}{
+		{"server.port", "8080", 8080, false},
+		{"SERVER.PORT", "8081", 8081, false},
+		{"server.allowUploads", "true", true, false},
+		{"server.interfaces", "eth0, wlan0", []string{"eth0", "wlan0"}, false},
+		{"server.port", "70000", nil, true},
+		{"server.port", "many", nil, true},
+		{"server.unknown", "1", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			ac := Default()
+			before := ac.Server.Port
+
+			err := ac.Set(tt.key, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Set succeeded, want an error")
+				}
+
+				if ac.Server.Port != before {
+					t.Errorf("invalid Set changed server.port to %v", ac.Server.Port)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, _ := ac.Get(tt.key)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Get = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetFixesInvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snett.toml")
+
+	content := `[server]
+port = 0
+
+[log]
+level = "loud"
+`
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ac, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each bad value can be fixed while the other is still bad
+	if err := ac.Set("log.level", "info"); err != nil {
+		t.Fatalf("fixing log.level = %v", err)
+	}
+
+	if err := ac.Set("server.name", ""); err == nil {
+		t.Fatalf("breaking server.name succeeded")
+	}
+
+	if err := ac.Set("server.port", "9091"); err != nil {
+		t.Fatalf("fixing server.port = %v", err)
+	}
+
+	if err := ac.Validate(); err != nil {
+		t.Errorf("Validate = %v", err)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snett.toml")
+
+	ac, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ac.CreateProfile("work", map[string]string{"allowUploads": "true", "port": "8080"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"WORK", "a.b", ""} {
+		if err := ac.CreateProfile(name, nil); err == nil {
+			t.Errorf("CreateProfile(%q) succeeded", name)
+		}
+	}
+
+	if err := ac.CreateProfile("home", map[string]string{"provider": "ssh"}); err == nil {
+		t.Errorf("profile overriding a tunnel setting was created")
+	}
+
+	if err := ac.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		profile string
+		port    int
+		uploads bool
+	}{
+		{"", 9091, false},
+		{"work", 8080, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			loaded, err := LoadProfile(path, tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if loaded.Server.Port != tt.port || loaded.Server.AllowUploads != tt.uploads {
+				t.Errorf("server = %+v, want port %v and uploads %v", loaded.Server, tt.port, tt.uploads)
+			}
+		})
+	}
+}
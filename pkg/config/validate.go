@@ -0,0 +1,205 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Owbird/SNetT-Engine/internal/logger"
+)
+
+var (
+	// Allowed values of the string settings
+	portFallbacks    = []string{"none", "next", "random"}
+	tunnelProviders  = []string{"localtunnel", "selfhosted", "ssh"}
+	logFormats       = []string{logger.FORMAT_TEXT, logger.FORMAT_JSON}
+	logDestinations  = []string{logger.DEST_STDOUT, logger.DEST_STDERR, logger.DEST_FILE}
+	accessLogFormats = []string{"combined", "json"}
+	notifiers        = []string{NOTIFIER_AUTO, NOTIFIER_DESKTOP, NOTIFIER_DBUS, NOTIFIER_LOG, NOTIFIER_PUSH, NOTIFIER_NONE}
+	pushServices     = []string{PUSH_NTFY, PUSH_GOTIFY}
+	clipboardModes   = []string{CLIPBOARD_AUTO, CLIPBOARD_ALWAYS, CLIPBOARD_NEVER}
+)
+
+// Validate checks the settings, returning an error that
+// describes every invalid one
+func (ac *AppConfig) Validate() error {
+	if errs := ac.problems(); len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// problems returns an error for every invalid setting
+func (ac *AppConfig) problems() []error {
+	var errs []error
+
+	invalid := func(key string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%v: %v", key, fmt.Sprintf(format, args...)))
+	}
+
+	oneOf := func(key string, value string, allowed []string) {
+		if !slices.Contains(allowed, value) {
+			invalid(key, "must be one of %v, got %q", strings.Join(allowed, ", "), value)
+		}
+	}
+
+	portRange := func(key string, port int) {
+		if port < 1 || port > 65535 {
+			invalid(key, "must be between 1 and 65535, got %v", port)
+		}
+	}
+
+	if s := ac.Server; s != nil {
+		if strings.TrimSpace(s.Name) == "" {
+			invalid("server.name", "must not be empty")
+		}
+
+		portRange("server.port", s.Port)
+		oneOf("server.portFallback", s.PortFallback, portFallbacks)
+
+		if l := s.Limits; l != nil {
+			limits := map[string]int{
+				"server.limits.bandwidth":        l.Bandwidth,
+				"server.limits.visitorBandwidth": l.VisitorBandwidth,
+				"server.limits.maxDownloads":     l.MaxDownloads,
+				"server.limits.filesPerMinute":   l.FilesPerMinute,
+			}
+
+			for _, key := range slices.Sorted(maps.Keys(limits)) {
+				if limits[key] < 0 {
+					invalid(key, "must not be negative, got %v", limits[key])
+				}
+			}
+		}
+	}
+
+	if n := ac.Notification; n != nil {
+		for _, notifier := range n.Notifiers {
+			oneOf("notification.notifiers", notifier, notifiers)
+		}
+
+		oneOf("notification.clipboard", n.Clipboard, clipboardModes)
+
+		if p := n.Push; p != nil && slices.Contains(n.Notifiers, NOTIFIER_PUSH) {
+			oneOf("notification.push.service", p.Service, pushServices)
+
+			if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				invalid("notification.push.url", "must be an http or https URL, got %q", p.URL)
+			}
+
+			switch p.Service {
+			case PUSH_NTFY:
+				if p.Topic == "" {
+					invalid("notification.push.topic", "is required for ntfy")
+				}
+
+				if p.Priority < 0 || p.Priority > 5 {
+					invalid("notification.push.priority", "must be between 0 and 5 for ntfy, where 0 is the server default, got %v", p.Priority)
+				}
+
+			case PUSH_GOTIFY:
+				if p.Token == "" {
+					invalid("notification.push.token", "is required for Gotify")
+				}
+
+				if p.Priority < 0 || p.Priority > 10 {
+					invalid("notification.push.priority", "must be between 0 and 10 for Gotify, got %v", p.Priority)
+				}
+			}
+
+			if p.Timeout < 0 {
+				invalid("notification.push.timeout", "must not be negative, got %v", p.Timeout)
+			}
+		}
+	}
+
+	if t := ac.Tunnel; t != nil {
+		oneOf("tunnel.provider", t.Provider, tunnelProviders)
+
+		if t.Provider == "selfhosted" && t.Host == "" {
+			invalid("tunnel.host", "is required for the selfhosted tunnel")
+		}
+
+		if t.Host != "" {
+			if u, err := url.Parse(t.Host); err != nil || u.Host == "" {
+				invalid("tunnel.host", "must be a URL, got %q", t.Host)
+			}
+		}
+
+		if ssh := t.SSH; ssh != nil && t.Provider == "ssh" {
+			if ssh.Address == "" {
+				invalid("tunnel.ssh.address", "is required for the ssh tunnel")
+			}
+
+			portRange("tunnel.ssh.remotePort", ssh.RemotePort)
+		}
+	}
+
+	if l := ac.Log; l != nil {
+		if _, err := logger.ParseLevel(l.Level); err != nil {
+			invalid("log.level", "must be one of debug, info, warn, error, got %q", l.Level)
+		}
+
+		oneOf("log.format", l.Format, logFormats)
+
+		for _, dest := range l.Destinations {
+			oneOf("log.destinations", dest, logDestinations)
+		}
+
+		oneOf("log.accessLogFormat", l.AccessLogFormat, accessLogFormats)
+
+		if l.MaxSize < 0 {
+			invalid("log.maxSize", "must not be negative, got %v", l.MaxSize)
+		}
+
+		if l.MaxAge < 0 {
+			invalid("log.maxAge", "must not be negative, got %v", l.MaxAge)
+		}
+
+		if l.MaxBackups < 0 {
+			invalid("log.maxBackups", "must not be negative, got %v", l.MaxBackups)
+		}
+	}
+
+	for i, hook := range ac.Hooks {
+		key := fmt.Sprintf("hooks[%v]", i)
+
+		if hook.URL == "" && hook.Command == "" {
+			invalid(key, "needs a url or a command")
+		}
+
+		if hook.URL != "" {
+			if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				invalid(key+".url", "must be an http or https URL, got %q", hook.URL)
+			}
+		}
+
+		if hook.Timeout < 0 {
+			invalid(key+".timeout", "must not be negative, got %v", hook.Timeout)
+		}
+
+		if hook.Retries < 0 {
+			invalid(key+".retries", "must not be negative, got %v", hook.Retries)
+		}
+	}
+
+	for _, name := range ac.ProfileNames() {
+		for key := range ac.Profiles[name] {
+			if _, ok := profileSetting(key); !ok {
+				invalid(fmt.Sprintf("profiles.%v.%v", name, key), "profiles can only set server and notification settings")
+			}
+		}
+	}
+
+	if ac.Profile != "" && !slices.ContainsFunc(ac.ProfileNames(), func(name string) bool {
+		return strings.EqualFold(name, ac.Profile)
+	}) {
+		invalid("profile", "no profile named %q, expected one of %v", ac.Profile, strings.Join(ac.ProfileNames(), ", "))
+	}
+
+	return errs
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(ac *AppConfig)
+		want   string
+	}{
+		{"defaults", func(ac *AppConfig) {}, ""},
+		{"port", func(ac *AppConfig) { ac.Server.Port = 70000 }, "server.port"},
+		{"empty name", func(ac *AppConfig) { ac.Server.Name = " " }, "server.name"},
+		{"port fallback", func(ac *AppConfig) { ac.Server.PortFallback = "any" }, "server.portFallback"},
+		{"negative limit", func(ac *AppConfig) { ac.Server.Limits.Bandwidth = -1 }, "server.limits.bandwidth"},
+		{"log level", func(ac *AppConfig) { ac.Log.Level = "loud" }, "log.level"},
+		{"ntfy", func(ac *AppConfig) { usePush(ac, 0) }, ""},
+		{"ntfy priority", func(ac *AppConfig) { usePush(ac, 6) }, "between 0 and 5"},
+		{"ntfy without url", func(ac *AppConfig) { usePush(ac, 0); ac.Notification.Push.URL = "" }, "notification.push.url"},
+		{"hook without target", func(ac *AppConfig) { ac.Hooks = []HookConfig{{}} }, "hooks[0]"},
+		{"unknown profile", func(ac *AppConfig) { ac.Profile = "work" }, "profile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ac := Default()
+			tt.change(ac)
+
+			err := ac.Validate()
+
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Validate = %v, want nil", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("Validate = %v, want an error about %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// usePush sends notifications to an ntfy topic with priority
+func usePush(ac *AppConfig, priority int) {
+	ac.Notification.Notifiers = []string{NOTIFIER_PUSH}
+	ac.Notification.Push.URL = "https://ntfy.sh"
+	ac.Notification.Push.Topic = "snett"
+	ac.Notification.Push.Priority = priority
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"errors"
+	"os"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ErrNoConfigFile is returned when watching a configuration
+// that was not loaded from a file
+var ErrNoConfigFile = errors.New("config was not loaded from a file")
+
+// Watch calls onChange whenever the config file is written, with
+// the settings read before and after the change. err is set when
+// the new file cannot be read or is invalid, in which case the
+// change should be ignored. ac itself is left unchanged.
+func (ac *AppConfig) Watch(onChange func(previous *AppConfig, updated *AppConfig, err error)) error {
+	if ac.v == nil || ac.path == "" {
+		return ErrNoConfigFile
+	}
+
+	if _, err := os.Stat(ac.path); err != nil {
+		return err
+	}
+
+	previous, err := decode(ac.v, ac.path)
+	if err != nil {
+		return err
+	}
+
+	ac.v.OnConfigChange(func(e fsnotify.Event) {
+		// Read the file again rather than using the watched settings,
+		// which keep their old values when the file fails to parse
+		updated, err := load(ac.path, ac.overrides, ac.profile)
+		if err == nil {
+			err = updated.Validate()
+		}
+
+		if err != nil {
+			onChange(previous, nil, err)
+			return
+		}
+
+		onChange(previous, updated, nil)
+		previous = updated
+	})
+
+	ac.v.WatchConfig()
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+)
+
+// How many events a subscriber can fall behind
+// by before events are dropped for it
+const DefaultBufferSize = 256
+
+// Bus delivers published events to every subscriber.
+// Publishing never blocks: a subscriber that falls
+// behind misses events instead of stalling the server.
+type Bus struct {
+	subscribers map[*Subscription]struct{}
+	mutex       sync.RWMutex
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events published on a bus
+type Subscription struct {
+	bus   *Bus
+	ch    chan Envelope
+	types map[Type]struct{}
+
+	// Called with the events the subscriber was too far behind to receive
+	overflow func(Envelope)
+
+	dropped   atomic.Uint64
+	closeOnce sync.Once
+}
+
+// Subscribe returns a subscription to the given event
+// types, or to every event when none are given
+func (b *Bus) Subscribe(types ...Type) *Subscription {
+	return b.SubscribeWithOverflow(nil, types...)
+}
+
+// SubscribeWithOverflow is like Subscribe, but the events dropped
+// because the subscriber fell behind are passed to overflow instead.
+// It is called while publishing, so it must not block.
+func (b *Bus) SubscribeWithOverflow(overflow func(Envelope), types ...Type) *Subscription {
+	sub := &Subscription{
+		bus:      b,
+		ch:       make(chan Envelope, DefaultBufferSize),
+		overflow: overflow,
+	}
+
+	if len(types) > 0 {
+		sub.types = make(map[Type]struct{})
+		for _, t := range types {
+			sub.types[t] = struct{}{}
+		}
+	}
+
+	b.mutex.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mutex.Unlock()
+
+	return sub
+}
+
+// Publish delivers an event to the subscribers. A nil
+// bus discards the event.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	envelope := Envelope{
+		Type:  event.Type(),
+		Time:  time.Now(),
+		Event: event,
+	}
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for sub := range b.subscribers {
+		if !sub.wants(envelope.Type) {
+			continue
+		}
+
+		select {
+		case sub.ch <- envelope:
+		default:
+			sub.dropped.Add(1)
+
+			if sub.overflow != nil {
+				sub.overflow(envelope)
+			}
+		}
+	}
+}
+
+func (s *Subscription) wants(t Type) bool {
+	if s.types == nil {
+		return true
+	}
+
+	_, found := s.types[t]
+
+	return found
+}
+
+// C returns the channel events are delivered on.
+// It is closed when the subscription is closed.
+func (s *Subscription) C() <-chan Envelope {
+	return s.ch
+}
+
+// Dropped returns how many events were missed
+// because the subscriber fell behind
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops delivery and closes the channel
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.bus.mutex.Lock()
+		delete(s.bus.subscribers, s)
+		s.bus.mutex.Unlock()
+
+		close(s.ch)
+	})
+}
+
+// ForwardServerLogs sends every event on the subscription to
+// logCh as a models.ServerLog until the subscription is closed.
+// It lets consumers of the older log channel keep working. Once
+// stop is closed, events logCh is not ready for are passed to
+// overflow instead, so a consumer that stopped reading cannot
+// keep the forwarding from finishing.
+func ForwardServerLogs(sub *Subscription, logCh chan<- models.ServerLog, stop <-chan struct{}, overflow func(Envelope)) {
+	for envelope := range sub.C() {
+		select {
+		case logCh <- envelope.Event.ServerLog():
+			continue
+		case <-stop:
+		}
+
+		select {
+		case logCh <- envelope.Event.ServerLog():
+		default:
+			if overflow != nil {
+				overflow(envelope)
+			}
+		}
+	}
+}
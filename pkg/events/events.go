@@ -0,0 +1,428 @@
+// Package events provides the typed events emitted by
+// the file server and a bus to deliver them
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/internal/utils"
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+)
+
+type Type string
+
+const (
+	// Server Event Types
+	LOG               Type = "log"
+	SERVER_ERROR      Type = "server_error"
+	SERVING_URL       Type = "serving_url"
+	VISITOR_JOINED    Type = "visitor_joined"
+	VISITOR_LEFT      Type = "visitor_left"
+	UPLOAD_COMPLETED  Type = "upload_completed"
+	UPLOAD_PENDING    Type = "upload_pending"
+	UPLOAD_REJECTED   Type = "upload_rejected"
+	DOWNLOAD_STARTED  Type = "download_started"
+	DOWNLOAD_FINISHED Type = "download_finished"
+	WORMHOLE_RECEIVED Type = "wormhole_received"
+	WORMHOLE_SHARED   Type = "wormhole_shared"
+	TUNNEL_STATUS     Type = "tunnel_status"
+	TUNNEL_UP         Type = "tunnel_up"
+	TUNNEL_DOWN       Type = "tunnel_down"
+	CONFIG_RELOADED   Type = "config_reloaded"
+	TRANSFER_FINISHED Type = "transfer_finished"
+)
+
+type ErrorCode string
+
+const (
+	// Server Error Codes
+	ERR_NETWORK  ErrorCode = "network"
+	ERR_LISTEN   ErrorCode = "listen"
+	ERR_SERVE    ErrorCode = "serve"
+	ERR_MDNS     ErrorCode = "mdns"
+	ERR_TUNNEL   ErrorCode = "tunnel"
+	ERR_WORMHOLE ErrorCode = "wormhole"
+	ERR_LOG      ErrorCode = "log"
+	ERR_CONFIG   ErrorCode = "config"
+)
+
+// Event is something that happened on the server
+type Event interface {
+	// The type of the event
+	Type() Type
+
+	// ServerLog describes the event as a
+	// models.ServerLog for older consumers
+	ServerLog() models.ServerLog
+}
+
+// Envelope is an event as delivered to subscribers
+type Envelope struct {
+	// The type of the event
+	Type Type `json:"type"`
+
+	// When the event was published
+	Time time.Time `json:"time"`
+
+	// The event itself
+	Event Event `json:"data"`
+}
+
+// Log is a free-form message about what the server is doing
+type Log struct {
+	Message string `json:"message"`
+}
+
+func (e Log) Type() Type { return LOG }
+
+func (e Log) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: e.Message,
+		Type:  models.API_LOG,
+	}
+}
+
+// Error is a failure on the server
+type Error struct {
+	// What part of the server failed
+	Code ErrorCode `json:"code"`
+
+	// Description of the failure
+	Message string `json:"message"`
+}
+
+func (e Error) Type() Type { return SERVER_ERROR }
+
+func (e Error) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: e.Message,
+		Type:  models.SERVER_ERROR,
+	}
+}
+
+// ServingURL is a URL visitors can open the web UI on
+type ServingURL struct {
+	URL string `json:"url"`
+
+	// Whether the URL is reachable from the internet
+	Remote bool `json:"remote"`
+}
+
+func (e ServingURL) Type() Type { return SERVING_URL }
+
+func (e ServingURL) ServerLog() models.ServerLog {
+	logType := models.SERVE_UI_LOCAL
+	if e.Remote {
+		logType = models.SERVE_UI_REMOTE
+	}
+
+	return models.ServerLog{
+		Value: e.URL,
+		Type:  logType,
+	}
+}
+
+// VisitorJoined is a visitor connecting to the web UI
+type VisitorJoined struct {
+	// The visitor's identifier
+	Visitor string `json:"visitor"`
+
+	// The visitor's address
+	Addr string `json:"addr"`
+
+	// How many visitors are connected
+	Visitors int `json:"visitors"`
+}
+
+func (e VisitorJoined) Type() Type { return VISITOR_JOINED }
+
+func (e VisitorJoined) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: e.Visitor,
+		Type:  models.WS_NEW_VISITOR,
+	}
+}
+
+// VisitorLeft is a visitor disconnecting from the web UI
+type VisitorLeft struct {
+	// The visitor's identifier
+	Visitor string `json:"visitor"`
+
+	// The visitor's address
+	Addr string `json:"addr"`
+
+	// How many visitors are still connected
+	Visitors int `json:"visitors"`
+}
+
+func (e VisitorLeft) Type() Type { return VISITOR_LEFT }
+
+func (e VisitorLeft) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: fmt.Sprintf("Visitor %v left", e.Visitor),
+		Type:  models.API_LOG,
+	}
+}
+
+// UploadCompleted is a file uploaded into the served directory
+type UploadCompleted struct {
+	// Where the file was saved
+	Path string `json:"path"`
+
+	// Size of the file in bytes
+	Size int64 `json:"size"`
+
+	// Address of the uploader
+	Visitor string `json:"visitor"`
+}
+
+func (e UploadCompleted) Type() Type { return UPLOAD_COMPLETED }
+
+func (e UploadCompleted) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: fmt.Sprintf("File received at %v", e.Path),
+		Type:  models.API_LOG,
+	}
+}
+
+// UploadPending is an uploaded file waiting in quarantine
+// for the host to approve it
+type UploadPending struct {
+	// Identifier to approve or reject the upload with
+	ID string `json:"id"`
+
+	// Where the file is saved once approved
+	Path string `json:"path"`
+
+	// Size of the file in bytes
+	Size int64 `json:"size"`
+
+	// Address of the uploader
+	Visitor string `json:"visitor"`
+}
+
+func (e UploadPending) Type() Type { return UPLOAD_PENDING }
+
+func (e UploadPending) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: fmt.Sprintf("Upload %v of %v from %v is waiting for approval", e.ID, e.Path, e.Visitor),
+		Type:  models.API_LOG,
+	}
+}
+
+// UploadRejected is the host rejecting a pending upload
+type UploadRejected struct {
+	// Identifier of the upload
+	ID string `json:"id"`
+
+	// Where the file would have been saved
+	Path string `json:"path"`
+
+	// Address of the uploader
+	Visitor string `json:"visitor"`
+}
+
+func (e UploadRejected) Type() Type { return UPLOAD_REJECTED }
+
+func (e UploadRejected) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: fmt.Sprintf("Upload %v of %v was rejected", e.ID, e.Path),
+		Type:  models.API_LOG,
+	}
+}
+
+// DownloadStarted is a visitor starting to download a file,
+// or an archive of several files
+type DownloadStarted struct {
+	// The file being downloaded
+	Path string `json:"path"`
+
+	// Size of the file in bytes
+	Size int64 `json:"size"`
+
+	// Address of the downloader
+	Visitor string `json:"visitor"`
+}
+
+func (e DownloadStarted) Type() Type { return DOWNLOAD_STARTED }
+
+func (e DownloadStarted) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: fmt.Sprintf("Downloading %v", e.Path),
+		Type:  models.API_LOG,
+	}
+}
+
+// DownloadFinished is a download that has been served
+type DownloadFinished struct {
+	// The file that was downloaded
+	Path string `json:"path"`
+
+	// How many bytes were sent
+	Bytes int64 `json:"bytes"`
+
+	// Address of the downloader
+	Visitor string `json:"visitor"`
+
+	// How long the download took
+	Duration time.Duration `json:"duration"`
+}
+
+func (e DownloadFinished) Type() Type { return DOWNLOAD_FINISHED }
+
+func (e DownloadFinished) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: fmt.Sprintf("Downloaded %v (%v in %v)", e.Path, utils.FmtBytes(e.Bytes), e.Duration.Round(time.Millisecond)),
+		Type:  models.API_LOG,
+	}
+}
+
+// WormholeReceived is a file received through the wormhole
+// into the served directory
+type WormholeReceived struct {
+	// Where the file was saved
+	Path string `json:"path"`
+}
+
+func (e WormholeReceived) Type() Type { return WORMHOLE_RECEIVED }
+
+func (e WormholeReceived) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: fmt.Sprintf("File received at %v", e.Path),
+		Type:  models.API_LOG,
+	}
+}
+
+// WormholeShared is served files sent through the wormhole
+type WormholeShared struct {
+	// The files that were sent
+	Files []string `json:"files"`
+}
+
+func (e WormholeShared) Type() Type { return WORMHOLE_SHARED }
+
+func (e WormholeShared) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: fmt.Sprintf("Shared %v through the wormhole", e.Files),
+		Type:  models.API_LOG,
+	}
+}
+
+// TransferFinished is a wormhole transfer that ended, whether
+// started from the command line or by a visitor
+type TransferFinished struct {
+	// Identifier of the transfer in the history, zero
+	// when the history is disabled
+	ID int `json:"id"`
+
+	// Whether the files were sent or received
+	Direction models.TransferDirection `json:"direction"`
+
+	// Name of the file or directory transferred
+	Name string `json:"name"`
+
+	// Total size of the transfer in bytes
+	Size int64 `json:"size"`
+
+	// How the transfer ended
+	Outcome models.TransferOutcome `json:"outcome"`
+
+	// The error the transfer failed with, if any
+	Error string `json:"error,omitempty"`
+
+	// How long the transfer took
+	Duration time.Duration `json:"duration"`
+}
+
+func (e TransferFinished) Type() Type { return TRANSFER_FINISHED }
+
+func (e TransferFinished) ServerLog() models.ServerLog {
+	value := fmt.Sprintf("Wormhole transfer of %v %v (%v)", e.Name, e.Outcome, utils.FmtBytes(e.Size))
+	if e.Error != "" {
+		value = fmt.Sprintf("%v: %v", value, e.Error)
+	}
+
+	return models.ServerLog{
+		Value: value,
+		Type:  models.API_LOG,
+	}
+}
+
+// TunnelStatus is progress on keeping the online tunnel open
+type TunnelStatus struct {
+	// The tunnel provider
+	Provider string `json:"provider"`
+
+	Message string `json:"message"`
+}
+
+func (e TunnelStatus) Type() Type { return TUNNEL_STATUS }
+
+func (e TunnelStatus) ServerLog() models.ServerLog {
+	return models.ServerLog{
+		Value: e.Message,
+		Type:  models.TUNNEL_STATUS,
+	}
+}
+
+// TunnelUp is the online tunnel being established
+type TunnelUp struct {
+	models.TunnelEvent
+}
+
+func (e TunnelUp) Type() Type { return TUNNEL_UP }
+
+func (e TunnelUp) ServerLog() models.ServerLog {
+	return tunnelServerLog(models.TUNNEL_UP, e.TunnelEvent)
+}
+
+// TunnelDown is the online tunnel going down
+type TunnelDown struct {
+	models.TunnelEvent
+}
+
+func (e TunnelDown) Type() Type { return TUNNEL_DOWN }
+
+func (e TunnelDown) ServerLog() models.ServerLog {
+	return tunnelServerLog(models.TUNNEL_DOWN, e.TunnelEvent)
+}
+
+func tunnelServerLog(logType models.LogType, event models.TunnelEvent) models.ServerLog {
+	eventJson, _ := json.Marshal(event)
+
+	return models.ServerLog{
+		Value: string(eventJson),
+		Type:  logType,
+	}
+}
+
+// ConfigReloaded is snett.toml changing while the server runs
+type ConfigReloaded struct {
+	// The settings applied to the running server
+	Applied []string `json:"applied"`
+
+	// The changed settings that need a restart
+	Restart []string `json:"restart"`
+}
+
+func (e ConfigReloaded) Type() Type { return CONFIG_RELOADED }
+
+func (e ConfigReloaded) ServerLog() models.ServerLog {
+	message := "Config reloaded"
+
+	if len(e.Applied) > 0 {
+		message += fmt.Sprintf(", applied %v", strings.Join(e.Applied, ", "))
+	}
+
+	if len(e.Restart) > 0 {
+		message += fmt.Sprintf(", restart the server to apply %v", strings.Join(e.Restart, ", "))
+	}
+
+	return models.ServerLog{
+		Value: message,
+		Type:  models.API_LOG,
+	}
+}
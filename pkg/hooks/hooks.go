@@ -0,0 +1,312 @@
+// Package hooks runs webhooks and local commands
+// when server events happen
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+)
+
+const (
+	// Headers sent with every webhook request
+	EventHeader     = "X-SNetT-Event"
+	SignatureHeader = "X-SNetT-Signature"
+)
+
+const (
+	// How long a webhook request or command may take
+	// when the hook sets no timeout
+	defaultTimeout = 10 * time.Second
+
+	// Delay before the first webhook retry
+	retryBackoff = 2 * time.Second
+
+	// Most webhook requests and commands run at once. Further
+	// events wait, and are skipped once the bus overflows.
+	maxRunning = 4
+)
+
+// Hooks runs the configured hooks for the events on a bus
+type Hooks struct {
+	hooks  []config.HookConfig
+	client *http.Client
+	log    *slog.Logger
+
+	// The events being listened to, and closed once
+	// they have all been handed to the hooks
+	sub  *events.Subscription
+	done chan struct{}
+
+	// Slots of the hooks running at once
+	slots   chan struct{}
+	running sync.WaitGroup
+}
+
+func NewHooks(hookConfigs []config.HookConfig, log *slog.Logger) *Hooks {
+	hooks := []config.HookConfig{}
+
+	for _, hook := range hookConfigs {
+		if hook.URL == "" && hook.Command == "" {
+			log.Warn("Ignoring hook without a url or command", "events", hook.Events)
+			continue
+		}
+
+		if hook.Timeout <= 0 {
+			hook.Timeout = defaultTimeout
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	return &Hooks{
+		hooks:  hooks,
+		client: &http.Client{},
+		log:    log,
+		slots:  make(chan struct{}, maxRunning),
+	}
+}
+
+// Listen runs the hooks for the events published on bus
+// until ctx is done or Close is called
+func (h *Hooks) Listen(ctx context.Context, bus *events.Bus) {
+	if len(h.hooks) == 0 {
+		return
+	}
+
+	h.sub = bus.SubscribeWithOverflow(func(envelope events.Envelope) {
+		h.log.Warn("Hooks fell behind, skipping event", "event", envelope.Type)
+	})
+	h.done = make(chan struct{})
+
+	go func() {
+		<-ctx.Done()
+		h.sub.Close()
+	}()
+
+	go func() {
+		defer close(h.done)
+
+		for envelope := range h.sub.C() {
+			h.fire(ctx, envelope)
+		}
+	}()
+}
+
+// Close stops listening and waits for the hooks of the events
+// published so far to finish, such as before a command exits
+func (h *Hooks) Close() {
+	if h.sub == nil {
+		return
+	}
+
+	h.sub.Close()
+	<-h.done
+
+	h.running.Wait()
+}
+
+// wants reports whether the hook runs for the event. Hooks without
+// events run for every event other than the log lines.
+func wants(hook config.HookConfig, eventType events.Type) bool {
+	if len(hook.Events) == 0 {
+		return eventType != events.LOG
+	}
+
+	return slices.Contains(hook.Events, string(eventType))
+}
+
+// fire runs every hook that wants the event
+func (h *Hooks) fire(ctx context.Context, envelope events.Envelope) {
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		h.log.Error("Failed to encode event", "event", envelope.Type, "err", err)
+		return
+	}
+
+	for _, hook := range h.hooks {
+		if !wants(hook, envelope.Type) {
+			continue
+		}
+
+		if hook.URL != "" {
+			h.start(ctx, func() {
+				if err := h.post(ctx, hook, envelope.Type, payload); err != nil {
+					h.log.Error("Webhook failed", "url", hook.URL, "event", envelope.Type, "err", err)
+				}
+			})
+		}
+
+		if hook.Command != "" {
+			h.start(ctx, func() {
+				if err := run(ctx, hook, envelope, payload); err != nil {
+					h.log.Error("Hook command failed", "command", hook.Command, "event", envelope.Type, "err", err)
+				}
+			})
+		}
+	}
+}
+
+// start runs fn in the background once fewer
+// than maxRunning hooks are running
+func (h *Hooks) start(ctx context.Context, fn func()) {
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+
+	h.running.Add(1)
+
+	go func() {
+		defer func() {
+			<-h.slots
+			h.running.Done()
+		}()
+
+		fn()
+	}()
+}
+
+// post delivers the payload to the webhook, retrying with
+// backoff on network errors and server errors
+func (h *Hooks) post(ctx context.Context, hook config.HookConfig, eventType events.Type, payload []byte) error {
+	backoff := retryBackoff
+
+	var err error
+
+	for attempt := 0; attempt <= hook.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+		}
+
+		var retry bool
+
+		retry, err = h.postOnce(ctx, hook, eventType, payload)
+		if err == nil || !retry {
+			return err
+		}
+	}
+
+	return err
+}
+
+// postOnce makes a single webhook request and
+// reports whether a failure is worth retrying
+func (h *Hooks) postOnce(ctx context.Context, hook config.HookConfig, eventType events.Type, payload []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, hook.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SNetT")
+	req.Header.Set(EventHeader, string(eventType))
+
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, payload))
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+
+	retry := res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+
+	return retry, fmt.Errorf("unexpected status %v", res.Status)
+}
+
+// Sign returns the signature sent with webhook payloads:
+// "sha256=" followed by the hex HMAC-SHA256 of the payload
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// run runs the hook command through the shell with
+// the event details in its environment
+func run(ctx context.Context, hook config.HookConfig, envelope events.Envelope, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, hook.Timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", hook.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	}
+
+	cmd.Env = append(os.Environ(), environ(envelope, payload)...)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// environ returns the event details as environment variables:
+// SNETT_EVENT, SNETT_EVENT_TIME, SNETT_EVENT_JSON and a
+// SNETT_<FIELD> variable for each field of the event
+func environ(envelope events.Envelope, payload []byte) []string {
+	env := []string{
+		"SNETT_EVENT=" + string(envelope.Type),
+		"SNETT_EVENT_TIME=" + envelope.Time.Format(time.RFC3339),
+		"SNETT_EVENT_JSON=" + string(payload),
+	}
+
+	eventJson, _ := json.Marshal(envelope.Event)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(eventJson, &fields); err != nil {
+		return env
+	}
+
+	for key, value := range fields {
+		var text string
+		if err := json.Unmarshal(value, &text); err != nil {
+			text = string(value)
+		}
+
+		env = append(env, fmt.Sprintf("SNETT_%v=%v", strings.ToUpper(key), text))
+	}
+
+	return env
+}
@@ -0,0 +1,119 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestWants(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		event  events.Type
+		want   bool
+	}{
+		{"every event", nil, events.UPLOAD_COMPLETED, true},
+		{"not log lines by default", nil, events.LOG, false},
+		{"listed", []string{"upload_completed"}, events.UPLOAD_COMPLETED, true},
+		{"not listed", []string{"upload_completed"}, events.VISITOR_JOINED, false},
+		{"log lines when listed", []string{"log"}, events.LOG, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wants(config.HookConfig{Events: tt.events}, tt.event); got != tt.want {
+				t.Errorf("wants = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHooksPost(t *testing.T) {
+	var (
+		received []string
+		mutex    sync.Mutex
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if r.Header.Get(SignatureHeader) != Sign("secret", body) {
+			t.Errorf("bad signature %q", r.Header.Get(SignatureHeader))
+		}
+
+		var envelope struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(body, &envelope)
+
+		mutex.Lock()
+		received = append(received, envelope.Type)
+		mutex.Unlock()
+	}))
+	defer srv.Close()
+
+	bus := events.NewBus()
+
+	h := NewHooks([]config.HookConfig{{URL: srv.URL, Secret: "secret"}}, discard)
+	h.Listen(context.Background(), bus)
+
+	bus.Publish(events.Log{Message: "Getting files"})
+	bus.Publish(events.UploadCompleted{Path: "a.txt"})
+	bus.Publish(events.TransferFinished{Name: "b.txt"})
+
+	h.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(received) != 2 {
+		t.Fatalf("received %v, want upload_completed and transfer_finished", received)
+	}
+}
+
+func TestHooksBoundConcurrency(t *testing.T) {
+	var running, most atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := running.Add(1)
+		defer running.Add(-1)
+
+		for {
+			m := most.Load()
+			if n <= m || most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	bus := events.NewBus()
+
+	h := NewHooks([]config.HookConfig{{URL: srv.URL}}, discard)
+	h.Listen(context.Background(), bus)
+
+	for i := 0; i < 3*maxRunning; i++ {
+		bus.Publish(events.UploadCompleted{Path: "a.txt"})
+	}
+
+	h.Close()
+
+	if most.Load() > maxRunning {
+		t.Errorf("%v hooks ran at once, want at most %v", most.Load(), maxRunning)
+	}
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type LogType string
 
 const (
@@ -9,6 +11,9 @@ const (
 	SERVE_UI_REMOTE LogType = "serve_web_ui_remote"
 	SERVER_ERROR    LogType = "server_error"
 	WS_NEW_VISITOR  LogType = "new_visitor"
+	TUNNEL_STATUS   LogType = "tunnel_status"
+	TUNNEL_UP       LogType = "tunnel_up"
+	TUNNEL_DOWN     LogType = "tunnel_down"
 )
 
 type Notification struct {
@@ -30,14 +35,95 @@ type ServerLog struct {
 	Value string
 }
 
+// TunnelEvent is the JSON value of TUNNEL_UP
+// and TUNNEL_DOWN server logs
+type TunnelEvent struct {
+	// The tunnel provider
+	Provider string `json:"provider"`
+
+	// The public URL of the tunnel
+	URL string `json:"url"`
+
+	// Why the tunnel went down
+	Error string `json:"error,omitempty"`
+
+	// How many times the tunnel has been re-established
+	Reconnects int `json:"reconnects"`
+
+	// When the event happened
+	Time time.Time `json:"time"`
+}
+
 type FileShareProgress struct {
-	Bytes      int64
-	Total      int64
-	Percentage int
+	Bytes      int64 `json:"bytes"`
+	Total      int64 `json:"total"`
+	Percentage int   `json:"percentage"`
 }
 
 type SNetTServer struct {
 	Name string
 	Port int
-	IP   string
+
+	// The preferred address, IPv4 when available
+	IP string
+
+	// Every IPv4 and IPv6 address the server advertised
+	IPs []string
+}
+
+type TransferDirection string
+
+const (
+	// Wormhole Transfer Directions
+	TRANSFER_SENT     TransferDirection = "sent"
+	TRANSFER_RECEIVED TransferDirection = "received"
+)
+
+type TransferOutcome string
+
+const (
+	// Wormhole Transfer Outcomes
+	TRANSFER_COMPLETED TransferOutcome = "completed"
+	TRANSFER_FAILED    TransferOutcome = "failed"
+	TRANSFER_CANCELLED TransferOutcome = "cancelled"
+)
+
+type TransferFile struct {
+	// Path of the file on this device
+	Path string `json:"path"`
+
+	// Size of the file in bytes
+	Size int64 `json:"size"`
+
+	// Hex encoded SHA-256 of the file contents
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+type TransferRecord struct {
+	// Identifier of the record in the transfer history
+	ID int `json:"id"`
+
+	// Whether the files were sent or received
+	Direction TransferDirection `json:"direction"`
+
+	// Name of the file or directory transferred
+	Name string `json:"name"`
+
+	// Total size of the transfer in bytes
+	Size int64 `json:"size"`
+
+	// Files that were part of the transfer
+	Files []TransferFile `json:"files"`
+
+	// When the transfer started
+	StartedAt time.Time `json:"started_at"`
+
+	// When the transfer finished
+	FinishedAt time.Time `json:"finished_at"`
+
+	// How the transfer ended
+	Outcome TransferOutcome `json:"outcome"`
+
+	// The error the transfer failed with, if any
+	Error string `json:"error,omitempty"`
 }
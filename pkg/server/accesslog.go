@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/internal/logger"
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+)
+
+const (
+	// Access log formats
+	ACCESS_LOG_COMBINED = "combined"
+	ACCESS_LOG_JSON     = "json"
+)
+
+// accessLogger writes a line for every HTTP request.
+// A nil *accessLogger writes nothing.
+type accessLogger struct {
+	out    io.Writer
+	format string
+	mutex  sync.Mutex
+}
+
+func newAccessLogger(out io.Writer, format string) (*accessLogger, error) {
+	switch format {
+	case "":
+		format = ACCESS_LOG_COMBINED
+	case ACCESS_LOG_COMBINED, ACCESS_LOG_JSON:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+
+	return &accessLogger{
+		out:    out,
+		format: format,
+	}, nil
+}
+
+// openAccessLog opens logs/access.log when the access log is enabled
+func openAccessLog(logConfig *config.LogConfig) (*accessLogger, error) {
+	if logConfig == nil || !logConfig.AccessLog {
+		return nil, nil
+	}
+
+	out, err := logger.OpenFile("access.log", logConfig.Rotation())
+	if err != nil {
+		return nil, err
+	}
+
+	return newAccessLogger(out, logConfig.AccessLogFormat)
+}
+
+// accessLogEntry is a line of the JSON access log
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs float64   `json:"duration_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// wrap logs the requests handled by next
+func (a *accessLogger) wrap(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		switch {
+		case rec.hijacked:
+			status = http.StatusSwitchingProtocols
+		case status == 0:
+			status = http.StatusOK
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		entry := accessLogEntry{
+			Time:       start,
+			RemoteAddr: host,
+			Method:     r.Method,
+			Path:       r.URL.RequestURI(),
+			Proto:      r.Proto,
+			Status:     status,
+			Bytes:      rec.written,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		}
+
+		a.write(entry)
+	})
+}
+
+func (a *accessLogger) write(entry accessLogEntry) {
+	var line []byte
+
+	if a.format == ACCESS_LOG_JSON {
+		line, _ = json.Marshal(entry)
+		line = append(line, '\n')
+	} else {
+		line = []byte(combinedLogLine(entry))
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.out.Write(line)
+}
+
+// combinedLogLine formats an entry in the Combined Log Format,
+// followed by the time taken in microseconds
+func combinedLogLine(entry accessLogEntry) string {
+	size := "-"
+	if entry.Bytes > 0 {
+		size = fmt.Sprint(entry.Bytes)
+	}
+
+	return fmt.Sprintf(
+		"%v - - [%v] %q %v %v %q %q %v\n",
+		entry.RemoteAddr,
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		fmt.Sprintf("%v %v %v", entry.Method, entry.Path, entry.Proto),
+		entry.Status,
+		size,
+		orDash(entry.Referer),
+		orDash(entry.UserAgent),
+		int64(entry.DurationMs*1000),
+	)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
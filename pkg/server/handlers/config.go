@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+)
+
+// Config returns the server settings the handlers are using
+func (h *Handlers) Config() config.ServerConfig {
+	h.configMutex.RLock()
+	defer h.configMutex.RUnlock()
+
+	return *h.serverConfig
+}
+
+// NotifConfig returns the notification settings
+// the handlers are using
+func (h *Handlers) NotifConfig() config.NotifConfig {
+	h.configMutex.RLock()
+	defer h.configMutex.RUnlock()
+
+	return *h.notifConfig
+}
+
+// SetConfig replaces the settings of the running server,
+// such as after snett.toml has changed, and pushes
+// them to every connected visitor
+func (h *Handlers) SetConfig(serverConfig config.ServerConfig, notifConfig config.NotifConfig) {
+	h.configMutex.Lock()
+	*h.serverConfig = serverConfig
+	*h.notifConfig = notifConfig
+	h.configMutex.Unlock()
+
+	h.limits.set(serverConfig.Limits)
+
+	h.broadcast(h.configMessage())
+}
+
+// configMessage returns the "CONFIG: <json>" websocket message
+func (h *Handlers) configMessage() string {
+	serverConfig := h.Config()
+	configJson, _ := json.Marshal(serverConfig)
+
+	return fmt.Sprintf("CONFIG: %v", string(configJson))
+}
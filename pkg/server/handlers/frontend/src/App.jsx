@@ -15,6 +15,8 @@ import {
   FaTimes,
   FaDownload,
   FaSpinner,
+  FaUpload,
+  FaExchangeAlt,
 } from "react-icons/fa";
 
 const fpPromise = FingerprintJS.load();
@@ -119,7 +121,7 @@ const Icon = {
   ToggleRight: FaChevronRight,
 };
 
-const FileViewModal = ({ file, onClose }) => {
+const FileViewModal = ({ file, onClose, onShare }) => {
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState(null);
 
@@ -284,6 +286,14 @@ const FileViewModal = ({ file, onClose }) => {
           >
             Close
           </button>
+          <button
+            onClick={() => onShare(file)}
+            className="inline-flex items-center gap-2 bg-blue-500 hover:bg-blue-600 text-white font-semibold py-2 px-6 rounded-lg transition-colors"
+            title="Get a wormhole code to receive this file on another device"
+          >
+            <FaExchangeAlt />
+            Share via wormhole
+          </button>
           <a
             href={`/download?file=${encodeURIComponent(file.path)}`}
             className="inline-flex items-center gap-2 bg-green-500 hover:bg-green-600 text-white font-semibold py-2 px-6 rounded-lg transition-colors"
@@ -298,6 +308,218 @@ const FileViewModal = ({ file, onClose }) => {
   );
 };
 
+const UPLOAD_STATES = {
+  pending: { label: "Waiting for approval", className: "bg-yellow-100 text-yellow-800" },
+  approved: { label: "Approved", className: "bg-green-100 text-green-800" },
+  rejected: { label: "Rejected", className: "bg-red-100 text-red-800" },
+};
+
+const UploadPanel = ({ currentPath, visitorId, uploads, onUploaded }) => {
+  const [selected, setSelected] = useState([]);
+  const [progress, setProgress] = useState(null);
+  const [message, setMessage] = useState("");
+  const inputRef = useRef(null);
+
+  const upload = () => {
+    if (!selected.length) return;
+
+    const formData = new FormData();
+    for (const file of selected) {
+      formData.append("file", file);
+    }
+    formData.append("uploadDir", currentPath);
+    formData.append("uid", visitorId);
+
+    const xhr = new XMLHttpRequest();
+
+    xhr.upload.addEventListener("progress", (event) => {
+      if (event.lengthComputable) {
+        setProgress((event.loaded / event.total) * 100);
+      }
+    });
+
+    xhr.addEventListener("load", () => {
+      setProgress(null);
+
+      if (xhr.status === 200) {
+        setMessage("Upload complete!");
+        onUploaded([]);
+      } else if (xhr.status === 202) {
+        // Uploads wait for the host to approve them
+        setMessage("Uploaded, waiting for the host to approve.");
+        try {
+          onUploaded(JSON.parse(xhr.responseText));
+        } catch (err) {
+          console.error("Failed to parse upload statuses", err);
+          onUploaded([]);
+        }
+      } else {
+        setMessage(`Error uploading files: ${xhr.responseText.trim() || xhr.status}`);
+        return;
+      }
+
+      setSelected([]);
+      if (inputRef.current) {
+        inputRef.current.value = "";
+      }
+    });
+
+    xhr.addEventListener("error", () => {
+      setProgress(null);
+      setMessage("Network error during upload.");
+    });
+
+    xhr.open("POST", "/upload", true);
+    xhr.send(formData);
+  };
+
+  return (
+    <div className="bg-white shadow-lg rounded-lg p-4 mb-6">
+      <div className="flex flex-col sm:flex-row sm:items-center gap-3">
+        <input
+          ref={inputRef}
+          type="file"
+          multiple
+          onChange={(e) => {
+            setSelected(Array.from(e.target.files));
+            setMessage("");
+          }}
+          className="text-sm text-gray-700 flex-1"
+        />
+        <button
+          onClick={upload}
+          disabled={!selected.length || progress !== null}
+          className="flex items-center gap-2 px-4 py-2 bg-blue-500 text-white rounded-lg hover:bg-blue-600 transition-colors font-medium disabled:opacity-50"
+        >
+          <FaUpload />
+          {selected.length > 1 ? `Upload ${selected.length} files` : "Upload"}
+        </button>
+      </div>
+
+      {progress !== null && (
+        <p className="text-sm text-gray-600 mt-2">Uploading: {progress.toFixed(2)}%</p>
+      )}
+      {message && <p className="text-sm text-gray-600 mt-2">{message}</p>}
+
+      {uploads.length > 0 && (
+        <ul className="mt-3 divide-y divide-gray-100">
+          {uploads.map((upload) => {
+            const state = UPLOAD_STATES[upload.state] || UPLOAD_STATES.pending;
+
+            return (
+              <li key={upload.id} className="flex items-center justify-between py-2 text-sm">
+                <span className="truncate font-medium text-gray-700">
+                  {upload.file}
+                  <span className="ml-2 text-gray-500 font-normal">
+                    {formatFileSize(upload.size)}
+                  </span>
+                </span>
+                <span className={`text-xs px-2 py-1 rounded-full ${state.className}`}>
+                  {state.label}
+                </span>
+              </li>
+            );
+          })}
+        </ul>
+      )}
+    </div>
+  );
+};
+
+const WORMHOLE_STATES = {
+  started: { label: "Waiting for the other device", className: "bg-yellow-100 text-yellow-800" },
+  code: { label: "Waiting for the other device", className: "bg-yellow-100 text-yellow-800" },
+  progress: { label: "Transferring", className: "bg-blue-100 text-blue-800" },
+  completed: { label: "Completed", className: "bg-green-100 text-green-800" },
+  failed: { label: "Failed", className: "bg-red-100 text-red-800" },
+  cancelled: { label: "Cancelled", className: "bg-gray-200 text-gray-700" },
+};
+
+const WORMHOLE_DONE = ["completed", "failed", "cancelled"];
+
+const WormholePanel = ({ currentPath, allowReceive, transfers, send }) => {
+  const [code, setCode] = useState("");
+
+  const receive = (e) => {
+    e.preventDefault();
+    if (!code.trim()) return;
+
+    send(`WORMHOLE_RECEIVE: ${JSON.stringify({ code: code.trim(), dir: currentPath })}`);
+    setCode("");
+  };
+
+  if (!allowReceive && transfers.length === 0) return null;
+
+  return (
+    <div className="bg-white shadow-lg rounded-lg p-4 mb-6">
+      {allowReceive && (
+        <form onSubmit={receive} className="flex flex-col sm:flex-row sm:items-center gap-3">
+          <input
+            type="text"
+            placeholder="Wormhole code, such as 7-crossword-puzzle"
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+            className="px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent flex-1"
+          />
+          <button
+            type="submit"
+            disabled={!code.trim()}
+            className="flex items-center gap-2 px-4 py-2 bg-blue-500 text-white rounded-lg hover:bg-blue-600 transition-colors font-medium disabled:opacity-50"
+          >
+            <FaExchangeAlt />
+            Receive here
+          </button>
+        </form>
+      )}
+
+      {transfers.length > 0 && (
+        <ul className={`divide-y divide-gray-100 ${allowReceive ? "mt-3" : ""}`}>
+          {transfers.map((transfer) => {
+            const state = WORMHOLE_STATES[transfer.state] || WORMHOLE_STATES.started;
+            const active = transfer.id && !WORMHOLE_DONE.includes(transfer.state);
+
+            return (
+              <li key={transfer.key} className="flex items-center justify-between gap-3 py-2 text-sm">
+                <div className="min-w-0">
+                  <p className="truncate font-medium text-gray-700">
+                    {transfer.action === "share" ? "Sharing" : "Receiving"} {transfer.file || ""}
+                  </p>
+                  {transfer.code && (
+                    <p className="text-gray-600">
+                      Code: <span className="font-mono select-all">{transfer.code}</span>
+                    </p>
+                  )}
+                  {transfer.progress && transfer.state === "progress" && (
+                    <p className="text-gray-500">
+                      {transfer.progress.percentage}% of {formatFileSize(transfer.progress.total)}
+                    </p>
+                  )}
+                  {transfer.error && <p className="text-red-500">{transfer.error}</p>}
+                </div>
+                <div className="flex items-center gap-2 flex-shrink-0">
+                  <span className={`text-xs px-2 py-1 rounded-full ${state.className}`}>
+                    {state.label}
+                  </span>
+                  {active && (
+                    <button
+                      onClick={() => send(`WORMHOLE_CANCEL: ${transfer.id}`)}
+                      className="p-1 hover:bg-gray-200 rounded-full transition-colors"
+                      aria-label="Cancel transfer"
+                      title="Cancel"
+                    >
+                      <FaTimes className="w-4 h-4 text-gray-600" />
+                    </button>
+                  )}
+                </div>
+              </li>
+            );
+          })}
+        </ul>
+      )}
+    </div>
+  );
+};
+
 const EmptyState = ({ category, searchQuery }) => {
   return (
     <tr>
@@ -328,8 +550,59 @@ function App() {
   const [selectedFile, setSelectedFile] = useState(null);
   const [connectionStatus, setConnectionStatus] = useState("connecting");
   const [error, setError] = useState(null);
+  const [uploads, setUploads] = useState([]);
+  const [transfers, setTransfers] = useState([]);
   const ws = useRef(null);
   const reconnectTimeout = useRef(null);
+  const currentPathRef = useRef("/");
+
+  useEffect(() => {
+    currentPathRef.current = currentPath;
+  }, [currentPath]);
+
+  // Adds uploads or updates the state of those already listed
+  const updateUploads = useCallback((statuses) => {
+    setUploads((cur) => {
+      const next = [...cur];
+      for (const status of statuses) {
+        const i = next.findIndex((u) => u.id === status.id);
+        if (i >= 0) {
+          next[i] = status;
+        } else {
+          next.push(status);
+        }
+      }
+      return next;
+    });
+  }, []);
+
+  // Updates a wormhole transfer, keeping the code and file of
+  // earlier statuses. Requests refused before they started have
+  // no id and are listed on their own.
+  const updateTransfers = useCallback((status) => {
+    setTransfers((cur) => {
+      const i = status.id ? cur.findIndex((t) => t.id === status.id) : -1;
+      if (i < 0) {
+        return [...cur, { ...status, key: status.id || `refused-${Date.now()}-${cur.length}` }];
+      }
+
+      const next = [...cur];
+      next[i] = { ...next[i], ...status };
+      return next;
+    });
+  }, []);
+
+  const send = useCallback((message) => {
+    if (ws.current && ws.current.readyState === WebSocket.OPEN) {
+      ws.current.send(message);
+    }
+  }, []);
+
+  const refreshFiles = useCallback(() => {
+    if (ws.current && ws.current.readyState === WebSocket.OPEN) {
+      ws.current.send(`FILES: ${currentPathRef.current}`);
+    }
+  }, []);
 
   const categories = [
     { key: "All Files", label: "All Files", icon: Icon.All },
@@ -373,6 +646,26 @@ function App() {
           } catch (err) {
             console.error("Failed to parse CONFIG message", err);
           }
+        } else if (message.startsWith("UPLOAD_STATUS:")) {
+          try {
+            const status = JSON.parse(message.replace("UPLOAD_STATUS: ", ""));
+            updateUploads([status]);
+            if (status.state === "approved") {
+              refreshFiles();
+            }
+          } catch (err) {
+            console.error("Failed to parse UPLOAD_STATUS message", err);
+          }
+        } else if (message.startsWith("WORMHOLE_STATUS:")) {
+          try {
+            const status = JSON.parse(message.replace("WORMHOLE_STATUS: ", ""));
+            updateTransfers(status);
+            if (status.action === "receive" && status.state === "completed") {
+              refreshFiles();
+            }
+          } catch (err) {
+            console.error("Failed to parse WORMHOLE_STATUS message", err);
+          }
         } else {
           console.log("RESPONSE:", message);
         }
@@ -396,7 +689,7 @@ function App() {
       console.error("Failed to connect", err);
       setError("Failed to establish connection");
     }
-  }, []);
+  }, [updateUploads, updateTransfers, refreshFiles]);
 
   useEffect(() => {
     connectWebSocket();
@@ -660,6 +953,25 @@ function App() {
             </div>
           </div>
 
+          {config.AllowUploads && (
+            <UploadPanel
+              currentPath={currentPath}
+              visitorId={visitorId}
+              uploads={uploads}
+              onUploaded={(statuses) => {
+                updateUploads(statuses);
+                refreshFiles();
+              }}
+            />
+          )}
+
+          <WormholePanel
+            currentPath={currentPath}
+            allowReceive={config.AllowUploads}
+            transfers={transfers}
+            send={send}
+          />
+
           {/* Files table */}
           <div className="bg-white shadow-lg rounded-lg overflow-hidden">
             <div className="overflow-x-auto">
@@ -780,6 +1092,11 @@ function App() {
             setShowFileViewModal(false);
             setSelectedFile(null);
           }}
+          onShare={(file) => {
+            send(`WORMHOLE_SHARE: ${JSON.stringify({ files: [file.path] })}`);
+            setShowFileViewModal(false);
+            setSelectedFile(null);
+          }}
         />
       )}
     </div>
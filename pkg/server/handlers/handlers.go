@@ -9,40 +9,124 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"log/slog"
 	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/Owbird/SNetT-Engine/internal/logger"
+	"github.com/Owbird/SNetT-Engine/internal/metrics"
+	"github.com/Owbird/SNetT-Engine/internal/qr"
+	"github.com/Owbird/SNetT-Engine/internal/ratelimit"
 	"github.com/Owbird/SNetT-Engine/internal/utils"
 	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
 	"github.com/Owbird/SNetT-Engine/pkg/models"
+	"github.com/Owbird/SNetT-Engine/pkg/wormhole"
 	"github.com/gorilla/websocket"
 	"github.com/sgtdi/fswatcher"
 )
 
+// How long a websocket message may take to send before
+// the visitor is treated as gone and disconnected
+const wsWriteTimeout = 10 * time.Second
+
 type Visitor struct {
 	uid string
 }
 
+// wsClient is a websocket connection to a visitor. Writes are
+// serialised as background transfers report to it as well.
+type wsClient struct {
+	conn       *websocket.Conn
+	writeMutex sync.Mutex
+	log        *slog.Logger
+
+	// Cancelled when the visitor disconnects
+	ctx context.Context
+
+	// The visitor on this connection, once connected
+	uid string
+
+	transfers      map[string]*wormhole.Transfer
+	transfersMutex sync.Mutex
+	transferCount  int
+}
+
+func (c *wsClient) WriteMessage(message string) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+
+	err := c.conn.WriteMessage(websocket.TextMessage, []byte(message))
+	if err != nil {
+		// A failed write leaves the connection unusable, so it is
+		// closed to end the read loop rather than stall later writes
+		c.conn.Close()
+	}
+
+	return err
+}
+
 type CacheItem struct {
 	files []File
 }
 
 type Handlers struct {
-	logCh        chan models.ServerLog
+	events       *events.Bus
+	log          *slog.Logger
 	dir          string
+	frontendDir  string
 	vistors      []Visitor
 	serverConfig *config.ServerConfig
 	notifConfig  *config.NotifConfig
-	Hosts        []string
+	configMutex  sync.RWMutex
 	cache        map[string]*CacheItem
 	cacheMutex   sync.RWMutex
+	wormhole     *wormhole.Wormhole
+
+	localHosts  []string
+	remoteHosts []string
+	hostsMutex  sync.RWMutex
+
+	clients      map[*wsClient]struct{}
+	clientsMutex sync.RWMutex
+
+	pendingUploads map[string]*PendingUpload
+	uploadsMutex   sync.Mutex
+
+	limits         *visitorLimits
+	trustForwarded atomic.Bool
+
+	metrics handlerMetrics
+}
+
+// handlerMetrics are recorded once RegisterMetrics is called
+type handlerMetrics struct {
+	cacheHits     *metrics.Counter
+	cacheMisses   *metrics.Counter
+	watcherEvents *metrics.Counter
+}
+
+// RegisterMetrics records the directory cache and
+// file watcher metrics in registry
+func (h *Handlers) RegisterMetrics(registry *metrics.Registry) {
+	h.metrics = handlerMetrics{
+		cacheHits:     registry.Counter("snett_cache_hits_total", "Directory listings served from the cache."),
+		cacheMisses:   registry.Counter("snett_cache_misses_total", "Directory listings read from disk."),
+		watcherEvents: registry.Counter("snett_watcher_events_total", "File changes seen in the served directory."),
+	}
+
+	h.metrics.cacheHits.Add(0)
+	h.metrics.cacheMisses.Add(0)
+	h.metrics.watcherEvents.Add(0)
 }
 
 type File struct {
@@ -85,43 +169,63 @@ type ViewHTML struct {
 
 var tmpl *template.Template
 
-func getFrontendDir() string {
+func getFrontendDir() (string, error) {
 	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
-		logger.Logger.Error("Failed to get templates dir")
-		os.Exit(1)
+		return "", fmt.Errorf("failed to get templates dir")
 	}
 
 	cwd := filepath.Dir(filename)
 
 	frontendDir := filepath.Join(cwd, "frontend", "dist")
 
-	return frontendDir
+	return frontendDir, nil
 }
 
+// NewHandlers returns the handlers serving dir, failing
+// when the web UI cannot be found or parsed
 func NewHandlers(
-	logCh chan models.ServerLog,
+	bus *events.Bus,
+	log *slog.Logger,
 	dir string,
-	serverConfig *config.ServerConfig,
-	notifConfig *config.NotifConfig,
-) *Handlers {
-	frontendDir := getFrontendDir()
+	appConfig *config.AppConfig,
+) (*Handlers, error) {
+	frontendDir, err := getFrontendDir()
+	if err != nil {
+		return nil, err
+	}
 
 	tpl, err := template.ParseGlob(filepath.Join(frontendDir, "/*.html"))
 	if err != nil {
-		logger.Logger.Error("Failed to parse glob", "err", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
 	}
 
 	tmpl = tpl
 
+	// The handlers keep their own copies, which SetConfig
+	// replaces while the caller may still be reading its own
+	serverConfig := *appConfig.GetSeverConfig()
+	notifConfig := *appConfig.GetNotifConfig()
+
+	wh := wormhole.NewWormhole(appConfig)
+	wh.DisableNotifications = true
+	wh.Logger = log
+	wh.Events = bus
+
 	return &Handlers{
-		logCh:        logCh,
+		events:       bus,
+		log:          log,
 		dir:          dir,
-		serverConfig: serverConfig,
-		notifConfig:  notifConfig,
+		frontendDir:  frontendDir,
+		serverConfig: &serverConfig,
+		notifConfig:  &notifConfig,
 		cache:        make(map[string]*CacheItem),
-	}
+		wormhole:     wh,
+		clients:      make(map[*wsClient]struct{}),
+
+		pendingUploads: make(map[string]*PendingUpload),
+		limits:         newVisitorLimits(serverConfig.Limits),
+	}, nil
 }
 
 func (h *Handlers) WatchFiles() {
@@ -132,9 +236,10 @@ func (h *Handlers) WatchFiles() {
 
 	ctx := context.Background()
 	go w.Watch(ctx)
-	logger.Logger.Info("fswatcher started, change a file in watcher dir")
+	h.log.Info("fswatcher started, change a file in watcher dir")
 
 	for event := range w.Events() {
+		h.metrics.watcherEvents.Inc()
 
 		dir := filepath.Dir(event.Path)
 
@@ -148,6 +253,28 @@ func (h *Handlers) WatchFiles() {
 
 }
 
+// resolvePath returns the full path of a path relative to
+// the served directory, rejecting paths that leave it
+func (h *Handlers) resolvePath(path string) (string, error) {
+	fullPath := filepath.Join(h.dir, filepath.FromSlash(path))
+
+	if fullPath != filepath.Clean(h.dir) && !isWithin(h.dir, fullPath) {
+		return "", fmt.Errorf("Invalid path")
+	}
+
+	return fullPath, nil
+}
+
+// isWithin reports whether path is inside dir, not dir itself
+func isWithin(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func (h *Handlers) getFiles(dir string) ([]File, error) {
 	files := []File{}
 
@@ -170,17 +297,13 @@ func (h *Handlers) getFiles(dir string) ([]File, error) {
 	h.cacheMutex.RUnlock()
 
 	if found {
-		h.logCh <- models.ServerLog{
-			Value: fmt.Sprintf("Using cached files for %v", fullPath),
-			Type:  models.API_LOG,
-		}
+		h.metrics.cacheHits.Inc()
+		h.events.Publish(events.Log{Message: fmt.Sprintf("Using cached files for %v", fullPath)})
 		files = item.files
 
 	} else {
-		h.logCh <- models.ServerLog{
-			Value: fmt.Sprintf("Getting files for %v", fullPath),
-			Type:  models.API_LOG,
-		}
+		h.metrics.cacheMisses.Inc()
+		h.events.Publish(events.Log{Message: fmt.Sprintf("Getting files for %v", fullPath)})
 
 		dirFiles, err := os.ReadDir(fullPath)
 		if err != nil {
@@ -220,18 +343,23 @@ func (h *Handlers) getFiles(dir string) ([]File, error) {
 }
 
 func (h *Handlers) GetFileUpload(w http.ResponseWriter, r *http.Request) {
-	h.logCh <- models.ServerLog{
-		Value: "Receiving files",
-		Type:  models.API_LOG,
+	if !h.Config().AllowUploads {
+		http.Error(w, "Uploads are not allowed", http.StatusForbidden)
+		return
 	}
+
+	h.events.Publish(events.Log{Message: "Receiving files"})
+
+	r.Body = io.NopCloser(ratelimit.NewReader(r.Context(), r.Body, h.limits.limiters(h.visitorIP(r))...))
+
 	reader, err := r.MultipartReader()
 	if err != nil {
-		logger.Logger.Error("MultipartReader error", "err", err)
+		h.log.Error("MultipartReader error", "err", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	var uploadDir string
+	var uploadDir, uid string
 	type filePart struct {
 		fileName string
 		data     []byte
@@ -254,8 +382,11 @@ func (h *Handlers) GetFileUpload(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			if part.FormName() == "uploadDir" {
+			switch part.FormName() {
+			case "uploadDir":
 				uploadDir = string(buf)
+			case "uid":
+				uid = string(buf)
 			}
 		} else {
 			buf, err := io.ReadAll(part)
@@ -270,8 +401,27 @@ func (h *Handlers) GetFileUpload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	approve := h.Config().ApproveUploads
+
+	var pending []*PendingUpload
+
 	for _, file := range files {
-		filePath := filepath.Join(h.dir, uploadDir, file.fileName)
+		filePath, err := h.resolvePath(uploadDir + "/" + file.fileName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if approve {
+			upload, err := h.stageUpload(file.data, filePath, r.RemoteAddr, uid)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			pending = append(pending, upload)
+			continue
+		}
 
 		// Create directory if it doesn't exist
 		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
@@ -284,10 +434,39 @@ func (h *Handlers) GetFileUpload(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		h.logCh <- models.ServerLog{
-			Value: fmt.Sprintf("File received at %v", filePath),
-			Type:  models.API_LOG,
+		h.events.Publish(events.UploadCompleted{
+			Path:    filePath,
+			Size:    int64(len(file.data)),
+			Visitor: r.RemoteAddr,
+		})
+	}
+
+	if approve {
+		statuses := make([]UploadStatus, 0, len(pending))
+		for _, upload := range pending {
+			statuses = append(statuses, upload.UploadStatus)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(statuses)
+
+		if len(pending) > 0 {
+			// Sending can take a while with push notifications
+			go h.notifyPendingUploads(pending, r.RemoteAddr)
 		}
+
+		return
+	}
+
+	if len(files) > 0 {
+		notifConfig := h.NotifConfig()
+
+		// Sending can take a while with push notifications
+		go notifConfig.SendNotification(h.log, models.Notification{
+			Title: "Files uploaded",
+			Body:  fmt.Sprintf("%v file(s) uploaded to %v", len(files), filepath.Join(h.dir, uploadDir)),
+		})
 	}
 }
 
@@ -307,22 +486,21 @@ func (h *Handlers) ViewFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	}
 
-	h.logCh <- models.ServerLog{
-		Value: fmt.Sprintf("Viewing %v", file),
-		Type:  models.API_LOG,
-	}
+	h.events.Publish(events.Log{Message: fmt.Sprintf("Viewing %v", file)})
 
 	fileType := filepath.Ext(file)
 
 	mimeType := mime.TypeByExtension(fileType)
 
+	serverConfig := h.Config()
+
 	tmpl.ExecuteTemplate(w, "view.html", ViewHTML{
 		File:     file,
 		MimeType: utils.StandardizeMimeType(mimeType),
-		Hosts:    h.Hosts,
+		Hosts:    h.Hosts(),
 		ServerConfig: IndexHTMLConfig{
-			Name:         h.serverConfig.Name,
-			AllowUploads: h.serverConfig.AllowUploads,
+			Name:         serverConfig.Name,
+			AllowUploads: serverConfig.AllowUploads,
 		},
 	})
 }
@@ -341,13 +519,21 @@ func (h *Handlers) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	}
 
+	done, ok := h.limits.startDownload()
+	if !ok {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Too many downloads, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer done()
+
 	files := strings.Split(query["file"][0], ",")
 
 	if len(files) > 1 {
 
 		tmpDir, err := os.MkdirTemp("", "snett-*")
 		if err != nil {
-			logger.Logger.Error("MkdirTemp error", "err", err)
+			h.log.Error("MkdirTemp error", "err", err)
 			http.Error(w, "Failed to download file", http.StatusInternalServerError)
 			return
 		}
@@ -355,7 +541,7 @@ func (h *Handlers) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
 		archivePath := filepath.Join(tmpDir, fmt.Sprintf("snett-%v.zip", time.Now().UnixNano()), "")
 		archive, err := os.Create(archivePath)
 		if err != nil {
-			logger.Logger.Error("Create archive error", "err", err)
+			h.log.Error("Create archive error", "err", err)
 			http.Error(w, "Failed to download file", http.StatusInternalServerError)
 			return
 		}
@@ -369,7 +555,7 @@ func (h *Handlers) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
 
 			file, err := os.Open(filePath)
 			if err != nil {
-				logger.Logger.Error("Open file error", "err", err)
+				h.log.Error("Open file error", "err", err)
 				http.Error(w, "Failed to download file", http.StatusInternalServerError)
 				return
 			}
@@ -378,12 +564,12 @@ func (h *Handlers) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
 
 			zip, err := zipWriter.Create(f)
 			if err != nil {
-				logger.Logger.Error("Create zip error", "err", err)
+				h.log.Error("Create zip error", "err", err)
 				http.Error(w, "Failed to download file", http.StatusInternalServerError)
 				return
 			}
 			if _, err := io.Copy(zip, file); err != nil {
-				logger.Logger.Error("Copy to zip error", "err", err)
+				h.log.Error("Copy to zip error", "err", err)
 				http.Error(w, "Failed to download file", http.StatusInternalServerError)
 				return
 			}
@@ -395,33 +581,69 @@ func (h *Handlers) DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%v", filepath.Base(archivePath)))
 		w.Header().Set("Content-Type", "application/octet-stream")
 
-		h.logCh <- models.ServerLog{
-			Value: fmt.Sprintf("Downloading %v", archivePath),
-			Type:  models.API_LOG,
-		}
-
-		http.ServeFile(w, r, archivePath)
+		h.serveDownload(w, r, archivePath)
 
 	} else {
 		file := filepath.Join(h.dir, query["file"][0])
 
-		h.logCh <- models.ServerLog{
-			Value: fmt.Sprintf("Downloading %v", file),
-			Type:  models.API_LOG,
-		}
-
 		if !query.Has("view") || query["view"][0] != "1" {
 			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%v", filepath.Base(file)))
 		}
 
-		http.ServeFile(w, r, file)
+		h.serveDownload(w, r, file)
 
 		return
 	}
 }
 
+// serveDownload serves a file, reporting when the
+// download starts and how much of it was sent
+func (h *Handlers) serveDownload(w http.ResponseWriter, r *http.Request, file string) {
+	var size int64
+	if info, err := os.Stat(file); err == nil {
+		size = info.Size()
+	}
+
+	h.events.Publish(events.DownloadStarted{
+		Path:    file,
+		Size:    size,
+		Visitor: r.RemoteAddr,
+	})
+
+	start := time.Now()
+	lw := &limitedResponseWriter{ResponseWriter: w}
+	lw.limited = ratelimit.NewWriter(r.Context(), w, h.limits.limiters(h.visitorIP(r))...)
+	cw := &countingResponseWriter{ResponseWriter: lw}
+
+	http.ServeFile(cw, r, file)
+
+	h.events.Publish(events.DownloadFinished{
+		Path:     file,
+		Bytes:    cw.written,
+		Visitor:  r.RemoteAddr,
+		Duration: time.Since(start),
+	})
+}
+
+// countingResponseWriter counts the bytes written to the response
+type countingResponseWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+
+	return n, err
+}
+
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func (h *Handlers) IndexHandler(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, fmt.Sprintf("%v/index.html", getFrontendDir()))
+	http.ServeFile(w, r, fmt.Sprintf("%v/index.html", h.frontendDir))
 
 	// tmpl.ExecuteTemplate(w, "index.html", IndexHTML{
 	// 	Files:       files,
@@ -437,12 +659,10 @@ func (h *Handlers) IndexHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) GetAssets(w http.ResponseWriter, r *http.Request) {
-	frontendDir := getFrontendDir()
-
 	path := r.URL.Path
-	data, err := os.ReadFile(filepath.Join(frontendDir, path))
+	data, err := os.ReadFile(filepath.Join(h.frontendDir, path))
 	if err != nil {
-		logger.Logger.Error("Failed to read asset", "err", err)
+		h.log.Error("Failed to read asset", "err", err)
 		http.NotFound(w, r)
 		return
 	}
@@ -453,58 +673,145 @@ func (h *Handlers) GetAssets(w http.ResponseWriter, r *http.Request) {
 	}
 	_, err = w.Write(data)
 	if err != nil {
-		logger.Logger.Error("Failed to write asset", "err", err)
+		h.log.Error("Failed to write asset", "err", err)
+	}
+}
+
+// HealthHandler reports that the server is up. It is used
+// to check that the online tunnel still reaches the server.
+func (h *Handlers) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// QRHandler serves a QR code PNG image of the text query
+// parameter, such as one of the hosts, with an optional size
+func (h *Handlers) QRHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	text := query.Get("text")
+	if len(text) == 0 {
+		http.Error(w, "Missing text", http.StatusBadRequest)
+		return
+	}
+
+	size := qr.DefaultPNGSize
+	if query.Has("size") {
+		s, err := strconv.Atoi(query.Get("size"))
+		if err != nil || s < 64 || s > 1024 {
+			http.Error(w, "Invalid size", http.StatusBadRequest)
+			return
+		}
+		size = s
+	}
+
+	png, err := qr.PNG(text, size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The text may be a share code or private URL, which
+	// shared caches such as the tunnel's must not keep
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, no-store")
+
+	_, err = w.Write(png)
+	if err != nil {
+		h.log.Error("Failed to write QR code", "err", err)
 	}
 }
 
 func (h *Handlers) HandleConnect(u *websocket.Upgrader, w http.ResponseWriter, r *http.Request) {
-	c, err := u.Upgrade(w, r, nil)
+	conn, err := u.Upgrade(w, r, nil)
 	if err != nil {
 		http.Error(w, "Failed to connect to server", http.StatusInternalServerError)
 		return
 	}
-	defer c.Close()
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &wsClient{
+		conn:      conn,
+		log:       h.log,
+		ctx:       ctx,
+		transfers: make(map[string]*wormhole.Transfer),
+	}
+
+	h.addClient(c)
+	defer h.removeClient(c)
+
+	var uid string
+	defer func() {
+		if uid != "" {
+			h.removeVisitor(uid, r.RemoteAddr)
+		}
+	}()
+
 	for {
-		mt, message, err := c.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
-			logger.Logger.Error("read message error", "err", err)
+			h.log.Error("read message error", "err", err)
 			return
 		}
-		logger.Logger.Info("recv", "message", string(message))
-
-		if uid := utils.ParseWsMessage(message, "CONNECT:"); uid != "" {
-			h.vistors = append(h.vistors, Visitor{
-				uid: uid,
-			})
+		h.log.Info("recv", "message", string(message))
 
-			h.logCh <- models.ServerLog{
-				Value: uid,
-				Type:  models.WS_NEW_VISITOR,
+		if connectUid := utils.ParseWsMessage(message, "CONNECT:"); connectUid != "" {
+			if uid == "" {
+				uid = connectUid
+				h.setClientUid(c, uid)
+				h.addVisitor(uid, r.RemoteAddr)
+			}
+			err = c.WriteMessage(h.configMessage())
+			if err != nil {
+				h.log.Error("write message error", "err", err)
 			}
-			configJson, _ := json.Marshal(h.serverConfig)
 
-			err = c.WriteMessage(mt, []byte(fmt.Sprintf("CONFIG: %v", string(configJson))))
+			err = c.WriteMessage(h.hostsMessage())
 			if err != nil {
-				logger.Logger.Error("write message error", "err", err)
+				h.log.Error("write message error", "err", err)
 			}
 
 		} else if dir := utils.ParseWsMessage(message, "FILES:"); dir != "" {
+			if !h.limits.files.Get(h.visitorIP(r)).Allow() {
+				h.log.Warn("Too many directory listings", "visitor", r.RemoteAddr)
+
+				err = c.WriteMessage("RATE_LIMITED: FILES")
+				if err != nil {
+					h.log.Error("write message error", "err", err)
+				}
+
+				continue
+			}
 
 			files, err := h.getFiles(dir)
 			if err != nil {
-				logger.Logger.Error("getFiles error", "err", err)
+				h.log.Error("getFiles error", "err", err)
 				return
 			}
 
 			filesJson, _ := json.Marshal(files)
 
-			logger.Logger.Info(string(filesJson))
+			h.log.Info(string(filesJson))
 
-			err = c.WriteMessage(mt, []byte(fmt.Sprintf("FILES: %v", string(filesJson))))
+			err = c.WriteMessage(fmt.Sprintf("FILES: %v", string(filesJson)))
 			if err != nil {
-				logger.Logger.Error("write message error", "err", err)
+				h.log.Error("write message error", "err", err)
 			}
 
+		} else if payload := utils.ParseWsMessage(message, "WORMHOLE_RECEIVE:"); payload != "" {
+			h.receiveWormhole(c, payload)
+
+		} else if payload := utils.ParseWsMessage(message, "WORMHOLE_SHARE:"); payload != "" {
+			h.shareWormhole(c, payload)
+
+		} else if id := utils.ParseWsMessage(message, "WORMHOLE_CANCEL:"); id != "" {
+			c.cancelTransfer(id)
+
 		}
 	}
 }
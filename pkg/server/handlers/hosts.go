@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+)
+
+// Hosts returns the URLs the server is reachable on,
+// local network hosts first
+func (h *Handlers) Hosts() []string {
+	h.hostsMutex.RLock()
+	defer h.hostsMutex.RUnlock()
+
+	return slices.Concat(h.localHosts, h.remoteHosts)
+}
+
+// SetLocalHosts replaces the local network hosts, such as
+// after the network interfaces have changed
+func (h *Handlers) SetLocalHosts(hosts []string) {
+	h.hostsMutex.Lock()
+	changed := !slices.Equal(h.localHosts, hosts)
+	h.localHosts = slices.Clone(hosts)
+	h.hostsMutex.Unlock()
+
+	if changed {
+		h.broadcastHosts()
+	}
+}
+
+// AddRemoteHost adds a public URL, such as the online tunnel
+func (h *Handlers) AddRemoteHost(host string) {
+	h.hostsMutex.Lock()
+	changed := !slices.Contains(h.remoteHosts, host)
+	if changed {
+		h.remoteHosts = append(h.remoteHosts, host)
+	}
+	h.hostsMutex.Unlock()
+
+	if changed {
+		h.broadcastHosts()
+	}
+}
+
+// RemoveRemoteHost removes a public URL that is no longer reachable
+func (h *Handlers) RemoveRemoteHost(host string) {
+	h.hostsMutex.Lock()
+	before := len(h.remoteHosts)
+	h.remoteHosts = slices.DeleteFunc(h.remoteHosts, func(remoteHost string) bool {
+		return remoteHost == host
+	})
+	changed := len(h.remoteHosts) != before
+	h.hostsMutex.Unlock()
+
+	if changed {
+		h.broadcastHosts()
+	}
+}
+
+// hostsMessage returns the "HOSTS: <json>" websocket message
+func (h *Handlers) hostsMessage() string {
+	hostsJson, _ := json.Marshal(h.Hosts())
+
+	return fmt.Sprintf("HOSTS: %v", string(hostsJson))
+}
+
+// broadcastHosts pushes the current hosts to every connected visitor
+func (h *Handlers) broadcastHosts() {
+	h.broadcast(h.hostsMessage())
+}
+
+// broadcast sends a message to every connected visitor
+func (h *Handlers) broadcast(message string) {
+	h.clientsMutex.RLock()
+	clients := make([]*wsClient, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.clientsMutex.RUnlock()
+
+	for _, c := range clients {
+		if err := c.WriteMessage(message); err != nil {
+			h.log.Error("write message error", "err", err)
+		}
+	}
+}
+
+// sendToVisitor sends a message to every connection of a visitor
+func (h *Handlers) sendToVisitor(uid string, message string) {
+	h.clientsMutex.RLock()
+	var clients []*wsClient
+	for c := range h.clients {
+		if c.uid == uid {
+			clients = append(clients, c)
+		}
+	}
+	h.clientsMutex.RUnlock()
+
+	for _, c := range clients {
+		if err := c.WriteMessage(message); err != nil {
+			h.log.Error("write message error", "err", err)
+		}
+	}
+}
+
+// setClientUid records the visitor on a connection
+func (h *Handlers) setClientUid(c *wsClient, uid string) {
+	h.clientsMutex.Lock()
+	c.uid = uid
+	h.clientsMutex.Unlock()
+}
+
+// addVisitor records a visitor who connected to the web UI
+func (h *Handlers) addVisitor(uid string, addr string) {
+	h.clientsMutex.Lock()
+	h.vistors = append(h.vistors, Visitor{
+		uid: uid,
+	})
+	visitors := len(h.vistors)
+	h.clientsMutex.Unlock()
+
+	h.events.Publish(events.VisitorJoined{
+		Visitor:  uid,
+		Addr:     addr,
+		Visitors: visitors,
+	})
+}
+
+// removeVisitor forgets a visitor who disconnected
+func (h *Handlers) removeVisitor(uid string, addr string) {
+	h.clientsMutex.Lock()
+	if i := slices.IndexFunc(h.vistors, func(v Visitor) bool { return v.uid == uid }); i >= 0 {
+		h.vistors = slices.Delete(h.vistors, i, i+1)
+	}
+	visitors := len(h.vistors)
+	h.clientsMutex.Unlock()
+
+	h.events.Publish(events.VisitorLeft{
+		Visitor:  uid,
+		Addr:     addr,
+		Visitors: visitors,
+	})
+}
+
+func (h *Handlers) addClient(c *wsClient) {
+	h.clientsMutex.Lock()
+	h.clients[c] = struct{}{}
+	h.clientsMutex.Unlock()
+}
+
+func (h *Handlers) removeClient(c *wsClient) {
+	h.clientsMutex.Lock()
+	delete(h.clients, c)
+	h.clientsMutex.Unlock()
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Owbird/SNetT-Engine/internal/ratelimit"
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+)
+
+// visitorLimits are the limiters following server.limits
+type visitorLimits struct {
+	// Bandwidth shared by every visitor
+	bandwidth *ratelimit.Limiter
+
+	// Bandwidth of each visitor IP
+	visitors *ratelimit.Group
+
+	// Directory listings of each visitor IP
+	files *ratelimit.Group
+
+	// Downloads allowed and being served at once
+	maxDownloads int
+	downloads    int
+	mutex        sync.Mutex
+}
+
+func newVisitorLimits(limitConfig *config.LimitConfig) *visitorLimits {
+	l := &visitorLimits{
+		bandwidth: ratelimit.NewLimiter(0, 0),
+		visitors:  ratelimit.NewGroup(0, 0),
+		files:     ratelimit.NewGroup(0, 0),
+	}
+
+	l.set(limitConfig)
+
+	return l
+}
+
+// bytesPerSecond converts a KiB/s setting to the rate and
+// burst of a limiter, allowing a second worth at once
+func bytesPerSecond(kib int) (float64, int) {
+	return float64(kib) * 1024, kib * 1024
+}
+
+// set applies limitConfig, such as after snett.toml has changed
+func (l *visitorLimits) set(limitConfig *config.LimitConfig) {
+	if limitConfig == nil {
+		limitConfig = &config.LimitConfig{}
+	}
+
+	l.bandwidth.SetLimit(bytesPerSecond(limitConfig.Bandwidth))
+	l.visitors.SetLimit(bytesPerSecond(limitConfig.VisitorBandwidth))
+	l.files.SetLimit(float64(limitConfig.FilesPerMinute)/60, limitConfig.FilesPerMinute)
+
+	l.mutex.Lock()
+	l.maxDownloads = limitConfig.MaxDownloads
+	l.mutex.Unlock()
+}
+
+// startDownload reports whether another download may start,
+// counting it until the returned func is called
+func (l *visitorLimits) startDownload() (func(), bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.maxDownloads > 0 && l.downloads >= l.maxDownloads {
+		return nil, false
+	}
+
+	l.downloads++
+
+	return func() {
+		l.mutex.Lock()
+		l.downloads--
+		l.mutex.Unlock()
+	}, true
+}
+
+// limiters returns the bandwidth limiters of the visitor at ip
+func (l *visitorLimits) limiters(ip string) []*ratelimit.Limiter {
+	return []*ratelimit.Limiter{l.bandwidth, l.visitors.Get(ip)}
+}
+
+// TrustForwardedFor sets whether requests from the loopback
+// address, such as those through the tunnel, are told apart by
+// the address the tunnel appends to X-Forwarded-For. Only
+// tunnels that append it may be trusted, as visitors can
+// send the header themselves.
+func (h *Handlers) TrustForwardedFor(trust bool) {
+	h.trustForwarded.Store(trust)
+}
+
+// visitorIP returns the address of the visitor making r
+func (h *Handlers) visitorIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !h.trustForwarded.Load() {
+		return host
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return host
+	}
+
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		return host
+	}
+
+	// The tunnel appends the address it saw last, after
+	// whatever the visitor sent
+	addrs := strings.Split(forwarded[len(forwarded)-1], ",")
+	if ip := net.ParseIP(strings.TrimSpace(addrs[len(addrs)-1])); ip != nil {
+		return ip.String()
+	}
+
+	return host
+}
+
+// limitedResponseWriter writes the response no faster
+// than the bandwidth limits allow
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	limited io.Writer
+}
+
+func (w *limitedResponseWriter) Write(b []byte) (int, error) {
+	return w.limited.Write(b)
+}
+
+func (w *limitedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQRHandler(t *testing.T) {
+	h := newTestHandlers(t)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"code", "?text=7-crossword-puzzle", http.StatusOK},
+		{"size", "?text=http://192.168.1.5:9091&size=128", http.StatusOK},
+		{"missing text", "", http.StatusBadRequest},
+		{"size too small", "?text=a&size=8", http.StatusBadRequest},
+		{"size not a number", "?text=a&size=big", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.QRHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/qr"+tt.query, nil))
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %v, want %v", w.Code, tt.want)
+			}
+
+			if tt.want == http.StatusOK && w.Header().Get("Cache-Control") != "private, no-store" {
+				t.Errorf("Cache-Control = %q, want private, no-store", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
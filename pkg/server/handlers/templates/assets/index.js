@@ -30,6 +30,27 @@ const cookBreadCrumbs = (path, container) => {
   `;
 };
 
+const uploadStateLabels = {
+  pending: "waiting for approval",
+  approved: "approved",
+  rejected: "rejected",
+};
+
+// Uploads waiting for approval, by id
+const uploads = {};
+
+const renderUploads = (container) => {
+  if (!container) return;
+
+  const items = Object.values(uploads).map((upload) => {
+    const item = document.createElement("li");
+    item.textContent = `${upload.file}: ${uploadStateLabels[upload.state] ?? upload.state}`;
+    return item;
+  });
+
+  container.replaceChildren(...items);
+};
+
 document.addEventListener("DOMContentLoaded", () => {
   const { host } = window.location;
 
@@ -44,6 +65,13 @@ document.addEventListener("DOMContentLoaded", () => {
     ws = null;
   };
   ws.onmessage = function (evt) {
+    if (evt.data.startsWith("UPLOAD_STATUS:")) {
+      const upload = JSON.parse(evt.data.replace("UPLOAD_STATUS: ", ""));
+      uploads[upload.id] = upload;
+      renderUploads(uploadList);
+      return;
+    }
+
     alert("RESPONSE: " + evt.data);
   };
   ws.onerror = function (evt) {
@@ -54,6 +82,7 @@ document.addEventListener("DOMContentLoaded", () => {
   const fileInput = document.getElementById("file-upload");
   const uploadButton = document.getElementById("upload-button");
   const uploadStatus = document.getElementById("upload-status");
+  const uploadList = document.getElementById("upload-list");
   const breadcrumbsContainer = document.getElementById("breadcrumbs");
 
   const { searchParams } = new URL(window.location.href);
@@ -79,6 +108,7 @@ document.addEventListener("DOMContentLoaded", () => {
     }
 
     formData.append("uploadDir", uploadDir);
+    formData.append("uid", window.uid);
 
     return new Promise((resolve, reject) => {
       const xhr = new XMLHttpRequest();
@@ -95,6 +125,14 @@ document.addEventListener("DOMContentLoaded", () => {
           uploadStatus.textContent = "Upload complete!";
           window.location.reload();
           resolve();
+        } else if (xhr.status === 202) {
+          // The uploads wait for the host to approve them
+          uploadStatus.textContent = "Uploaded, waiting for the host to approve.";
+          for (const upload of JSON.parse(xhr.responseText)) {
+            uploads[upload.id] = upload;
+          }
+          renderUploads(uploadList);
+          resolve();
         } else {
           uploadStatus.textContent = "Error uploading files.";
           reject(new Error("Upload failed"));
@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/internal/utils"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+)
+
+type UploadState string
+
+const (
+	UPLOAD_PENDING  UploadState = "pending"
+	UPLOAD_APPROVED UploadState = "approved"
+	UPLOAD_REJECTED UploadState = "rejected"
+)
+
+// ErrUploadNotFound is returned when approving or rejecting an
+// upload that is not waiting for approval
+var ErrUploadNotFound = errors.New("no pending upload with this id")
+
+// UploadStatus is sent to a visitor as "UPLOAD_STATUS: <json>"
+// to report on a file they uploaded while uploads need approval
+type UploadStatus struct {
+	// Identifier of the upload
+	ID string `json:"id"`
+
+	// Path of the file relative to the served directory
+	File string `json:"file"`
+
+	// Size of the file in bytes
+	Size int64 `json:"size"`
+
+	// Whether the file is waiting, approved or rejected
+	State UploadState `json:"state"`
+}
+
+// PendingUpload is an uploaded file waiting in
+// quarantine for the host to approve it
+type PendingUpload struct {
+	UploadStatus
+
+	// Address of the uploader
+	Visitor string `json:"visitor"`
+
+	// When the file was uploaded
+	Time time.Time `json:"time"`
+
+	// Where the file waits in quarantine
+	staged string
+
+	// Where the file is saved once approved
+	dest string
+
+	// The visitor to report the status to
+	uid string
+}
+
+// quarantineEntry is saved as <id>.json next to the staged
+// upload, so it can still be decided after a restart
+type quarantineEntry struct {
+	PendingUpload
+
+	// Where the file is saved once approved
+	Dest string `json:"dest"`
+
+	// The visitor to report the status to
+	UID string `json:"uid"`
+}
+
+// quarantineDir returns where uploads to the served directory
+// wait for approval. Each served directory has its own, so
+// uploads are only ever offered for the directory they were
+// sent to.
+func (h *Handlers) quarantineDir() (string, error) {
+	snettDir, err := utils.GetSNetTDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := filepath.Abs(h.dir)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(dir))
+
+	return filepath.Join(snettDir, "quarantine", hex.EncodeToString(hash[:8])), nil
+}
+
+// entryPath returns where the entry of a staged upload is saved
+func entryPath(staged string) string {
+	return filepath.Dir(staged) + ".json"
+}
+
+// saveEntry saves the entry of a pending upload
+func saveEntry(upload *PendingUpload) error {
+	entryJson, err := json.Marshal(quarantineEntry{
+		PendingUpload: *upload,
+		Dest:          upload.dest,
+		UID:           upload.uid,
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(entryPath(upload.staged), entryJson, 0600)
+}
+
+// removeStaged deletes a staged upload and its entry
+func removeStaged(upload *PendingUpload) error {
+	if err := os.RemoveAll(filepath.Dir(upload.staged)); err != nil {
+		return err
+	}
+
+	if err := os.Remove(entryPath(upload.staged)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// LoadQuarantine restores the uploads left waiting for approval
+// when the server last stopped. Staged files without an entry,
+// and entries without their file, cannot be decided and are
+// deleted.
+func (h *Handlers) LoadQuarantine() error {
+	dir, err := h.quarantineDir()
+	if err != nil {
+		return err
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	restored := map[string]bool{}
+
+	for _, dirEntry := range dirEntries {
+		id, ok := strings.CutSuffix(dirEntry.Name(), ".json")
+		if !ok || dirEntry.IsDir() {
+			continue
+		}
+
+		upload, err := h.loadEntry(filepath.Join(dir, dirEntry.Name()))
+		if err != nil || upload.ID != id {
+			h.log.Warn("Removing an upload that cannot be restored from quarantine", "id", id, "err", err)
+			os.RemoveAll(filepath.Join(dir, id))
+			os.Remove(filepath.Join(dir, dirEntry.Name()))
+			continue
+		}
+
+		h.uploadsMutex.Lock()
+		h.pendingUploads[id] = upload
+		h.uploadsMutex.Unlock()
+
+		restored[id] = true
+
+		h.events.Publish(events.UploadPending{
+			ID:      id,
+			Path:    upload.dest,
+			Size:    upload.Size,
+			Visitor: upload.Visitor,
+		})
+	}
+
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() && !restored[dirEntry.Name()] {
+			h.log.Warn("Removing an upload without an entry from quarantine", "id", dirEntry.Name())
+			os.RemoveAll(filepath.Join(dir, dirEntry.Name()))
+		}
+	}
+
+	return nil
+}
+
+// loadEntry reads the entry of a staged upload and checks that
+// it is saved to the served directory and that the staged file
+// is still there
+func (h *Handlers) loadEntry(path string) (*PendingUpload, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry quarantineEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	if entry.ID == "" || entry.Dest == "" {
+		return nil, fmt.Errorf("incomplete quarantine entry")
+	}
+
+	if !isUploadID(entry.ID) {
+		return nil, fmt.Errorf("invalid upload id %q", entry.ID)
+	}
+
+	dest := filepath.Clean(entry.Dest)
+	if !isWithin(h.dir, dest) {
+		return nil, fmt.Errorf("%v is outside the served directory", entry.Dest)
+	}
+
+	upload := entry.PendingUpload
+	upload.dest = dest
+	upload.uid = entry.UID
+	upload.staged = filepath.Join(strings.TrimSuffix(path, ".json"), filepath.Base(dest))
+
+	if _, err := os.Stat(upload.staged); err != nil {
+		return nil, err
+	}
+
+	return &upload, nil
+}
+
+// isUploadID reports whether id is in the format of newUploadID
+func isUploadID(id string) bool {
+	decoded, err := hex.DecodeString(id)
+
+	return err == nil && len(decoded) == 8
+}
+
+func newUploadID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// newStagingDir creates the quarantine directory a new upload waits in
+func (h *Handlers) newStagingDir() (string, string, error) {
+	dir, err := h.quarantineDir()
+	if err != nil {
+		return "", "", err
+	}
+
+	id := newUploadID()
+	staging := filepath.Join(dir, id)
+
+	if err := os.MkdirAll(staging, 0700); err != nil {
+		return "", "", err
+	}
+
+	return id, staging, nil
+}
+
+// stageUpload saves an uploaded file in quarantine until
+// the host approves it to be moved to dest
+func (h *Handlers) stageUpload(data []byte, dest string, visitor string, uid string) (*PendingUpload, error) {
+	id, staging, err := h.newStagingDir()
+	if err != nil {
+		return nil, err
+	}
+
+	staged := filepath.Join(staging, filepath.Base(dest))
+
+	if err := os.WriteFile(staged, data, 0600); err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+
+	return h.addPendingUpload(id, staged, dest, visitor, uid, int64(len(data)))
+}
+
+// stageReceived records a file received into the staging
+// directory of upload id as waiting for approval
+func (h *Handlers) stageReceived(id string, staged string, dest string, visitor string, uid string) (*PendingUpload, error) {
+	info, err := os.Stat(staged)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%v is not a file", filepath.Base(staged))
+	}
+
+	return h.addPendingUpload(id, staged, dest, visitor, uid, info.Size())
+}
+
+// addPendingUpload records a file staged in quarantine as
+// waiting for the host to approve it to be moved to dest
+func (h *Handlers) addPendingUpload(id string, staged string, dest string, visitor string, uid string, size int64) (*PendingUpload, error) {
+	rel, _ := filepath.Rel(h.dir, dest)
+
+	upload := &PendingUpload{
+		UploadStatus: UploadStatus{
+			ID:    id,
+			File:  filepath.ToSlash(rel),
+			Size:  size,
+			State: UPLOAD_PENDING,
+		},
+		Visitor: visitor,
+		Time:    time.Now(),
+		staged:  staged,
+		dest:    dest,
+		uid:     uid,
+	}
+
+	if err := saveEntry(upload); err != nil {
+		removeStaged(upload)
+		return nil, err
+	}
+
+	h.uploadsMutex.Lock()
+	h.pendingUploads[id] = upload
+	h.uploadsMutex.Unlock()
+
+	h.events.Publish(events.UploadPending{
+		ID:      id,
+		Path:    dest,
+		Size:    upload.Size,
+		Visitor: visitor,
+	})
+
+	h.sendUploadStatus(upload)
+
+	return upload, nil
+}
+
+// PendingUploads returns the uploads waiting for approval, oldest first
+func (h *Handlers) PendingUploads() []PendingUpload {
+	h.uploadsMutex.Lock()
+	defer h.uploadsMutex.Unlock()
+
+	uploads := make([]PendingUpload, 0, len(h.pendingUploads))
+	for _, upload := range h.pendingUploads {
+		uploads = append(uploads, *upload)
+	}
+
+	slices.SortFunc(uploads, func(a, b PendingUpload) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	return uploads
+}
+
+// takeUpload removes a pending upload so it is decided only once
+func (h *Handlers) takeUpload(id string) (*PendingUpload, error) {
+	h.uploadsMutex.Lock()
+	defer h.uploadsMutex.Unlock()
+
+	upload, ok := h.pendingUploads[id]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+
+	delete(h.pendingUploads, id)
+
+	return upload, nil
+}
+
+// ApproveUpload moves a pending upload into the served directory
+func (h *Handlers) ApproveUpload(id string) error {
+	upload, err := h.takeUpload(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(upload.dest), 0755); err != nil {
+		h.restoreUpload(upload)
+		return err
+	}
+
+	if err := moveFile(upload.staged, upload.dest); err != nil {
+		h.restoreUpload(upload)
+		return err
+	}
+
+	removeStaged(upload)
+
+	upload.State = UPLOAD_APPROVED
+
+	h.events.Publish(events.UploadCompleted{
+		Path:    upload.dest,
+		Size:    upload.Size,
+		Visitor: upload.Visitor,
+	})
+
+	h.sendUploadStatus(upload)
+
+	return nil
+}
+
+// RejectUpload deletes a pending upload
+func (h *Handlers) RejectUpload(id string) error {
+	upload, err := h.takeUpload(id)
+	if err != nil {
+		return err
+	}
+
+	if err := removeStaged(upload); err != nil {
+		h.restoreUpload(upload)
+		return err
+	}
+
+	upload.State = UPLOAD_REJECTED
+
+	h.events.Publish(events.UploadRejected{
+		ID:      upload.ID,
+		Path:    upload.dest,
+		Visitor: upload.Visitor,
+	})
+
+	h.sendUploadStatus(upload)
+
+	return nil
+}
+
+// restoreUpload puts back an upload that could not be decided
+func (h *Handlers) restoreUpload(upload *PendingUpload) {
+	h.uploadsMutex.Lock()
+	h.pendingUploads[upload.ID] = upload
+	h.uploadsMutex.Unlock()
+}
+
+// sendUploadStatus reports the state of an upload to its uploader
+func (h *Handlers) sendUploadStatus(upload *PendingUpload) {
+	if upload.uid == "" {
+		return
+	}
+
+	statusJson, _ := json.Marshal(upload.UploadStatus)
+
+	h.sendToVisitor(upload.uid, fmt.Sprintf("UPLOAD_STATUS: %v", string(statusJson)))
+}
+
+// notifyPendingUploads tells the host that uploads are waiting
+func (h *Handlers) notifyPendingUploads(uploads []*PendingUpload, visitor string) {
+	names := make([]string, 0, len(uploads))
+	for _, upload := range uploads {
+		names = append(names, fmt.Sprintf("%v (%v)", upload.File, utils.FmtBytes(upload.Size)))
+	}
+
+	notifConfig := h.NotifConfig()
+	notifConfig.SendNotification(h.log, models.Notification{
+		Title: "Upload waiting for approval",
+		Body:  fmt.Sprintf("%v uploaded %v", visitor, strings.Join(names, ", ")),
+	})
+}
+
+// moveFile moves a file, copying it when it is on another device
+func moveFile(src string, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(dest)
+		return err
+	}
+
+	return os.Remove(src)
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestHandlers returns handlers serving a temporary
+// directory, with ~/.snett in another one
+func newTestHandlers(t *testing.T) *Handlers {
+	t.Helper()
+
+	t.Setenv("HOME", t.TempDir())
+
+	return &Handlers{
+		log:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+		dir:            t.TempDir(),
+		clients:        make(map[*wsClient]struct{}),
+		pendingUploads: make(map[string]*PendingUpload),
+	}
+}
+
+func TestApproveUpload(t *testing.T) {
+	h := newTestHandlers(t)
+	dest := filepath.Join(h.dir, "docs", "a.txt")
+
+	upload, err := h.stageUpload([]byte("hello"), dest, "10.0.0.2:1234", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file saved before approval: %v", err)
+	}
+
+	if err := h.ApproveUpload(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("approved file = %q, %v", data, err)
+	}
+
+	if _, err := os.Stat(filepath.Dir(upload.staged)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("staged upload left in quarantine: %v", err)
+	}
+
+	if _, err := os.Stat(entryPath(upload.staged)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("quarantine entry left behind: %v", err)
+	}
+
+	if err := h.ApproveUpload(upload.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("approving twice = %v, want ErrUploadNotFound", err)
+	}
+}
+
+func TestRejectUpload(t *testing.T) {
+	h := newTestHandlers(t)
+	dest := filepath.Join(h.dir, "a.txt")
+
+	upload, err := h.stageUpload([]byte("hello"), dest, "10.0.0.2:1234", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.RejectUpload(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("rejected file saved: %v", err)
+	}
+
+	if len(h.PendingUploads()) != 0 {
+		t.Errorf("rejected upload still pending")
+	}
+}
+
+func TestLoadQuarantine(t *testing.T) {
+	h := newTestHandlers(t)
+	dest := filepath.Join(h.dir, "a.txt")
+
+	upload, err := h.stageUpload([]byte("hello"), dest, "10.0.0.2:1234", "visitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, _ := h.quarantineDir()
+
+	// Left by a crash before the entry was saved
+	orphan := filepath.Join(dir, "orphan")
+	os.MkdirAll(orphan, 0700)
+	os.WriteFile(filepath.Join(orphan, "b.txt"), []byte("b"), 0600)
+
+	// An entry whose file is gone
+	os.WriteFile(filepath.Join(dir, "missing.json"), []byte(`{"id":"missing","dest":"/tmp/c.txt"}`), 0600)
+
+	restarted := &Handlers{
+		log:            h.log,
+		dir:            h.dir,
+		clients:        make(map[*wsClient]struct{}),
+		pendingUploads: make(map[string]*PendingUpload),
+	}
+
+	if err := restarted.LoadQuarantine(); err != nil {
+		t.Fatal(err)
+	}
+
+	pending := restarted.PendingUploads()
+	if len(pending) != 1 || pending[0].ID != upload.ID || pending[0].uid != "visitor" {
+		t.Fatalf("restored uploads = %+v", pending)
+	}
+
+	for _, path := range []string{orphan, filepath.Join(dir, "missing.json")} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%v not cleaned up: %v", path, err)
+		}
+	}
+
+	if err := restarted.ApproveUpload(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := os.ReadFile(dest); err != nil || string(data) != "hello" {
+		t.Errorf("approved file = %q, %v", data, err)
+	}
+}
+
+func TestLoadQuarantineOtherDir(t *testing.T) {
+	h := newTestHandlers(t)
+
+	if _, err := h.stageUpload([]byte("hello"), filepath.Join(h.dir, "a.txt"), "10.0.0.2:1234", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	other := &Handlers{
+		log:            h.log,
+		dir:            t.TempDir(),
+		clients:        make(map[*wsClient]struct{}),
+		pendingUploads: make(map[string]*PendingUpload),
+	}
+
+	if err := other.LoadQuarantine(); err != nil {
+		t.Fatal(err)
+	}
+
+	if pending := other.PendingUploads(); len(pending) != 0 {
+		t.Errorf("uploads to another directory restored: %+v", pending)
+	}
+}
+
+func TestLoadEntryRejected(t *testing.T) {
+	h := newTestHandlers(t)
+	dir, _ := h.quarantineDir()
+
+	tests := []struct {
+		name string
+		id   string
+		dest string
+	}{
+		{"invalid id", "../../a", filepath.Join(h.dir, "a.txt")},
+		{"short id", "0123", filepath.Join(h.dir, "a.txt")},
+		{"outside the served directory", "0123456789abcdef", filepath.Join(filepath.Dir(h.dir), "a.txt")},
+		{"leaves the served directory", "0123456789abcdef", h.dir + "/../a.txt"},
+		{"served directory", "0123456789abcdef", h.dir},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "0123456789abcdef.json")
+			staged := filepath.Join(dir, "0123456789abcdef", filepath.Base(tt.dest))
+
+			os.MkdirAll(filepath.Dir(staged), 0700)
+			os.WriteFile(staged, []byte("hello"), 0600)
+
+			entryJson, _ := json.Marshal(quarantineEntry{
+				PendingUpload: PendingUpload{UploadStatus: UploadStatus{ID: tt.id}},
+				Dest:          tt.dest,
+			})
+			os.WriteFile(path, entryJson, 0600)
+
+			if upload, err := h.loadEntry(path); err == nil {
+				t.Errorf("loadEntry() = %+v, want an error", upload)
+			}
+		})
+	}
+}
+
+func TestStageReceived(t *testing.T) {
+	h := newTestHandlers(t)
+	dest := filepath.Join(h.dir, "a.txt")
+
+	// The wormhole receives into the staging directory
+	id, staging, err := h.newStagingDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staged := filepath.Join(staging, "a.txt")
+	os.WriteFile(staged, []byte("hello"), 0600)
+
+	upload, err := h.stageReceived(id, staged, dest, "10.0.0.2:1234", "visitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(dest); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("file saved before approval: %v", err)
+	}
+
+	pending := h.PendingUploads()
+	if len(pending) != 1 || pending[0].ID != id || pending[0].File != "a.txt" || pending[0].Size != 5 {
+		t.Fatalf("pending uploads = %+v", pending)
+	}
+
+	if err := h.ApproveUpload(upload.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := os.ReadFile(dest); err != nil || string(data) != "hello" {
+		t.Errorf("approved file = %q, %v", data, err)
+	}
+
+	if _, err := os.Stat(staging); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("staging directory left in quarantine: %v", err)
+	}
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+	"github.com/Owbird/SNetT-Engine/pkg/wormhole"
+)
+
+// errFolderNeedsApproval refuses wormhole folders, as only
+// single files can wait in quarantine for approval
+var errFolderNeedsApproval = errors.New("Folders cannot be received while uploads need approval")
+
+type WormholeAction string
+
+const (
+	WORMHOLE_RECEIVE WormholeAction = "receive"
+	WORMHOLE_SHARE   WormholeAction = "share"
+)
+
+type WormholeState string
+
+const (
+	WORMHOLE_STARTED   WormholeState = "started"
+	WORMHOLE_CODE      WormholeState = "code"
+	WORMHOLE_PROGRESS  WormholeState = "progress"
+	WORMHOLE_COMPLETED WormholeState = "completed"
+	WORMHOLE_FAILED    WormholeState = "failed"
+	WORMHOLE_CANCELLED WormholeState = "cancelled"
+)
+
+// WormholeStatus is sent to a visitor as "WORMHOLE_STATUS: <json>"
+// to report on a wormhole transfer they started
+type WormholeStatus struct {
+	// Identifier of the transfer on this connection
+	ID string `json:"id"`
+
+	// What the transfer is doing
+	Action WormholeAction `json:"action"`
+
+	// The current state of the transfer
+	State WormholeState `json:"state"`
+
+	// The code to enter on the receiving device
+	Code string `json:"code,omitempty"`
+
+	// Path of the file relative to the served directory
+	File string `json:"file,omitempty"`
+
+	// Progress of the transfer
+	Progress *models.FileShareProgress `json:"progress,omitempty"`
+
+	// Why the transfer failed
+	Error string `json:"error,omitempty"`
+}
+
+// WormholeReceiveRequest is sent by a visitor as
+// "WORMHOLE_RECEIVE: <json>" to have the server
+// receive a file into the served directory
+type WormholeReceiveRequest struct {
+	// The code from the sending device
+	Code string `json:"code"`
+
+	// Directory to save to, relative to the served directory
+	Dir string `json:"dir"`
+}
+
+// WormholeShareRequest is sent by a visitor as
+// "WORMHOLE_SHARE: <json>" to have the host share
+// served files through the wormhole
+type WormholeShareRequest struct {
+	// Files to share, relative to the served directory
+	Files []string `json:"files"`
+}
+
+// sendWormholeStatus writes a transfer status to the visitor
+func (c *wsClient) sendWormholeStatus(status WormholeStatus) {
+	statusJson, _ := json.Marshal(status)
+
+	err := c.WriteMessage(fmt.Sprintf("WORMHOLE_STATUS: %v", string(statusJson)))
+	if err != nil {
+		c.log.Error("write message error", "err", err)
+	}
+}
+
+// startTransfer tracks a transfer so the visitor can cancel it.
+// Transfers are cancelled when the visitor disconnects.
+func (c *wsClient) startTransfer(start func(ctx context.Context, id string) *wormhole.Transfer) {
+	c.transfersMutex.Lock()
+	c.transferCount++
+	id := strconv.Itoa(c.transferCount)
+	c.transfersMutex.Unlock()
+
+	transfer := start(c.ctx, id)
+
+	c.transfersMutex.Lock()
+	c.transfers[id] = transfer
+	c.transfersMutex.Unlock()
+
+	go func() {
+		<-transfer.Done()
+
+		c.transfersMutex.Lock()
+		delete(c.transfers, id)
+		c.transfersMutex.Unlock()
+	}()
+}
+
+// cancelTransfer stops a transfer started on this connection
+func (c *wsClient) cancelTransfer(id string) {
+	c.transfersMutex.Lock()
+	transfer, found := c.transfers[id]
+	c.transfersMutex.Unlock()
+
+	if found {
+		transfer.Cancel()
+	}
+}
+
+// progressReporter forwards progress to the visitor
+// only when the percentage changes
+func (c *wsClient) progressReporter(id string, action WormholeAction, file string) func(progress models.FileShareProgress) {
+	lastPercentage := -1
+
+	return func(progress models.FileShareProgress) {
+		if progress.Percentage == lastPercentage {
+			return
+		}
+		lastPercentage = progress.Percentage
+
+		c.sendWormholeStatus(WormholeStatus{
+			ID:       id,
+			Action:   action,
+			State:    WORMHOLE_PROGRESS,
+			File:     file,
+			Progress: &progress,
+		})
+	}
+}
+
+// receiveWormhole receives a file through the wormhole into the
+// served directory on behalf of a visitor
+func (h *Handlers) receiveWormhole(c *wsClient, payload string) {
+	var req WormholeReceiveRequest
+
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || req.Code == "" {
+		c.sendWormholeStatus(WormholeStatus{
+			Action: WORMHOLE_RECEIVE,
+			State:  WORMHOLE_FAILED,
+			Error:  "Invalid wormhole request",
+		})
+		return
+	}
+
+	if !h.Config().AllowUploads {
+		c.sendWormholeStatus(WormholeStatus{
+			Action: WORMHOLE_RECEIVE,
+			State:  WORMHOLE_FAILED,
+			Error:  "Uploads are not allowed",
+		})
+		return
+	}
+
+	dir, err := h.resolvePath(req.Dir)
+	if err != nil {
+		c.sendWormholeStatus(WormholeStatus{
+			Action: WORMHOLE_RECEIVE,
+			State:  WORMHOLE_FAILED,
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	// While uploads need approval, the file waits in quarantine
+	// like any other upload instead of going into dir
+	approve := h.Config().ApproveUploads
+	saveDir := dir
+
+	var uploadID string
+	if approve {
+		uploadID, saveDir, err = h.newStagingDir()
+		if err != nil {
+			c.sendWormholeStatus(WormholeStatus{
+				Action: WORMHOLE_RECEIVE,
+				State:  WORMHOLE_FAILED,
+				Error:  err.Error(),
+			})
+			return
+		}
+	}
+
+	visitor := c.conn.RemoteAddr().String()
+	uid := c.uid
+
+	h.events.Publish(events.Log{Message: fmt.Sprintf("Receiving wormhole transfer into %v", dir)})
+
+	c.startTransfer(func(ctx context.Context, id string) *wormhole.Transfer {
+		c.sendWormholeStatus(WormholeStatus{
+			ID:     id,
+			Action: WORMHOLE_RECEIVE,
+			State:  WORMHOLE_STARTED,
+		})
+
+		return h.wormhole.ReceiveTo(ctx, req.Code, saveDir, wormhole.ReceiveCallBacks{
+			OnProgressChange: c.progressReporter(id, WORMHOLE_RECEIVE, ""),
+			OnOffer: func(name string, isDir bool) error {
+				if approve && isDir {
+					return errFolderNeedsApproval
+				}
+
+				return nil
+			},
+			OnFileReceived: func(path string) {
+				if approve {
+					upload, err := h.stageReceived(uploadID, path, filepath.Join(dir, filepath.Base(path)), visitor, uid)
+					if err != nil {
+						os.RemoveAll(saveDir)
+
+						h.events.Publish(events.Error{
+							Code:    events.ERR_WORMHOLE,
+							Message: fmt.Sprintf("Wormhole receive failed: %v", err),
+						})
+
+						c.sendWormholeStatus(failedStatus(id, WORMHOLE_RECEIVE, err))
+						return
+					}
+
+					c.sendWormholeStatus(WormholeStatus{
+						ID:     id,
+						Action: WORMHOLE_RECEIVE,
+						State:  WORMHOLE_COMPLETED,
+						File:   upload.File,
+					})
+
+					// Sending can take a while with push notifications
+					go h.notifyPendingUploads([]*PendingUpload{upload}, visitor)
+					return
+				}
+
+				h.events.Publish(events.WormholeReceived{Path: path})
+
+				rel, _ := filepath.Rel(h.dir, path)
+
+				c.sendWormholeStatus(WormholeStatus{
+					ID:     id,
+					Action: WORMHOLE_RECEIVE,
+					State:  WORMHOLE_COMPLETED,
+					File:   filepath.ToSlash(rel),
+				})
+			},
+			OnReceiveErr: func(err error) {
+				if approve {
+					os.RemoveAll(saveDir)
+				}
+
+				h.events.Publish(events.Error{
+					Code:    events.ERR_WORMHOLE,
+					Message: fmt.Sprintf("Wormhole receive failed: %v", err),
+				})
+
+				c.sendWormholeStatus(failedStatus(id, WORMHOLE_RECEIVE, err))
+			},
+		})
+	})
+}
+
+// failedStatus reports why a transfer stopped
+func failedStatus(id string, action WormholeAction, err error) WormholeStatus {
+	state := WORMHOLE_FAILED
+	if errors.Is(err, wormhole.ErrTransferCancelled) {
+		state = WORMHOLE_CANCELLED
+	}
+
+	return WormholeStatus{
+		ID:     id,
+		Action: action,
+		State:  state,
+		Error:  err.Error(),
+	}
+}
+
+// shareWormhole shares files from the served directory through
+// the wormhole on behalf of a visitor, who receives the code
+func (h *Handlers) shareWormhole(c *wsClient, payload string) {
+	var req WormholeShareRequest
+
+	if err := json.Unmarshal([]byte(payload), &req); err != nil || len(req.Files) == 0 {
+		c.sendWormholeStatus(WormholeStatus{
+			Action: WORMHOLE_SHARE,
+			State:  WORMHOLE_FAILED,
+			Error:  "Invalid wormhole request",
+		})
+		return
+	}
+
+	files := []string{}
+
+	for _, file := range req.Files {
+		path, err := h.resolvePath(file)
+		if err == nil && path == h.dir {
+			err = fmt.Errorf("Invalid path")
+		}
+
+		// Only files can be sent; folders are refused before
+		// the visitor is given a code that would never work
+		if err == nil {
+			info, statErr := os.Stat(path)
+
+			switch {
+			case statErr != nil:
+				err = fmt.Errorf("File not found")
+			case info.IsDir():
+				err = fmt.Errorf("Folders cannot be shared, share the files in it instead")
+			}
+		}
+
+		if err != nil {
+			c.sendWormholeStatus(WormholeStatus{
+				Action: WORMHOLE_SHARE,
+				State:  WORMHOLE_FAILED,
+				File:   file,
+				Error:  err.Error(),
+			})
+			return
+		}
+
+		files = append(files, path)
+	}
+
+	file := strings.Join(req.Files, ",")
+
+	h.events.Publish(events.Log{Message: fmt.Sprintf("Sharing %v through the wormhole", file)})
+
+	c.startTransfer(func(ctx context.Context, id string) *wormhole.Transfer {
+		c.sendWormholeStatus(WormholeStatus{
+			ID:     id,
+			Action: WORMHOLE_SHARE,
+			State:  WORMHOLE_STARTED,
+			File:   file,
+		})
+
+		return h.wormhole.ShareFiles(ctx, files, wormhole.ShareCallBacks{
+			OnCodeReceive: func(code string) {
+				c.sendWormholeStatus(WormholeStatus{
+					ID:     id,
+					Action: WORMHOLE_SHARE,
+					State:  WORMHOLE_CODE,
+					Code:   code,
+					File:   file,
+				})
+			},
+			OnProgressChange: c.progressReporter(id, WORMHOLE_SHARE, file),
+			OnFileSent: func() {
+				h.events.Publish(events.WormholeShared{Files: req.Files})
+
+				c.sendWormholeStatus(WormholeStatus{
+					ID:     id,
+					Action: WORMHOLE_SHARE,
+					State:  WORMHOLE_COMPLETED,
+					File:   file,
+				})
+			},
+			OnSendErr: func(err error) {
+				h.events.Publish(events.Error{
+					Code:    events.ERR_WORMHOLE,
+					Message: fmt.Sprintf("Wormhole share failed: %v", err),
+				})
+
+				status := failedStatus(id, WORMHOLE_SHARE, err)
+				status.File = file
+
+				c.sendWormholeStatus(status)
+			},
+		})
+	})
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// testClient connects a websocket to a server that runs
+// handle on the wsClient of the connection
+func testClient(t *testing.T, h *Handlers, handle func(c *wsClient)) *websocket.Conn {
+	t.Helper()
+
+	var upgrader websocket.Upgrader
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		handle(&wsClient{conn: conn, log: h.log, ctx: r.Context()})
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestShareWormholeRefused(t *testing.T) {
+	h := newTestHandlers(t)
+
+	os.MkdirAll(filepath.Join(h.dir, "docs"), 0755)
+
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"folder", []string{"/docs"}, "Folders cannot be shared"},
+		{"missing file", []string{"/missing.txt"}, "File not found"},
+		{"outside the served directory", []string{"../secret.txt"}, "Invalid path"},
+		{"served directory", []string{"/"}, "Invalid path"},
+		{"no files", nil, "Invalid wormhole request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, _ := json.Marshal(WormholeShareRequest{Files: tt.files})
+
+			conn := testClient(t, h, func(c *wsClient) {
+				h.shareWormhole(c, string(payload))
+			})
+
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var status WormholeStatus
+			json.Unmarshal([]byte(strings.TrimPrefix(string(message), "WORMHOLE_STATUS: ")), &status)
+
+			if status.State != WORMHOLE_FAILED || !strings.Contains(status.Error, tt.want) {
+				t.Errorf("status = %+v, want a failure with %q", status, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/Owbird/SNetT-Engine/pkg/server/handlers"
+)
+
+// UploadsPath lists the uploads waiting for approval. They are
+// decided with POST UploadsPath/{id}/approve and /reject.
+const UploadsPath = "/api/v1/uploads"
+
+// fromHost reports whether r was made on the machine running
+// the server, rather than by a visitor or through the tunnel
+func fromHost(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback() && !isTunnelled(r)
+}
+
+// hostOnly answers requests not made on the host with 403. Web
+// pages are refused too, as any site the host visits could
+// otherwise make requests to the loopback address.
+func hostOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !fromHost(r) || r.Header.Get("Origin") != "" {
+			http.Error(w, "Only available on the host", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// pendingUploadsHandler lists the uploads waiting for approval
+func (s *Server) pendingUploadsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.PendingUploads())
+}
+
+// decideUploadHandler approves or rejects the upload {id}
+func (s *Server) decideUploadHandler(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		if approve {
+			err = s.ApproveUpload(r.PathValue("id"))
+		} else {
+			err = s.RejectUpload(r.PathValue("id"))
+		}
+
+		switch {
+		case errors.Is(err, handlers.ErrUploadNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostOnly(t *testing.T) {
+	tunnelledAddrs.mutex.Lock()
+	tunnelledAddrs.addrs["127.0.0.1:40000"] = struct{}{}
+	tunnelledAddrs.mutex.Unlock()
+
+	t.Cleanup(func() {
+		tunnelledAddrs.mutex.Lock()
+		delete(tunnelledAddrs.addrs, "127.0.0.1:40000")
+		tunnelledAddrs.mutex.Unlock()
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		origin     string
+		want       int
+	}{
+		{"loopback", "127.0.0.1:50000", "", http.StatusOK},
+		{"ipv6 loopback", "[::1]:50000", "", http.StatusOK},
+		{"lan visitor", "192.168.1.20:50000", "", http.StatusForbidden},
+		{"tunnelled", "127.0.0.1:40000", "", http.StatusForbidden},
+		{"web page", "127.0.0.1:50000", "http://example.com", http.StatusForbidden},
+	}
+
+	handler := hostOnly(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, UploadsPath, nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+}
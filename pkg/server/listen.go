@@ -0,0 +1,158 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+)
+
+const (
+	// Port fallbacks when the configured port is taken
+	PORT_FALLBACK_NONE   = "none"
+	PORT_FALLBACK_NEXT   = "next"
+	PORT_FALLBACK_RANDOM = "random"
+)
+
+// How many ports after the configured one are tried
+const maxPortAttempts = 20
+
+// listen binds every listen address on the configured port, falling
+// back to another port if it is taken. Other errors, such as a bind
+// address missing from the machine, are returned as they are. It
+// returns the listeners and the port they are bound to.
+func listen(serverConfig *config.ServerConfig) ([]net.Listener, int, error) {
+	addrs, err := listenAddrs(serverConfig, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hosts := []string{}
+	for _, addr := range addrs {
+		host, _, _ := net.SplitHostPort(addr)
+		hosts = append(hosts, host)
+	}
+
+	return listenHosts(hosts, serverConfig.Port, serverConfig.PortFallback)
+}
+
+// listenHosts binds every host on port, falling back to
+// another port as fallback allows if it is taken
+func listenHosts(hosts []string, port int, fallback string) ([]net.Listener, int, error) {
+	switch fallback {
+	case "", PORT_FALLBACK_NONE:
+		listeners, err := listenOn(hosts, port)
+		return listeners, port, err
+
+	case PORT_FALLBACK_NEXT:
+		var errs []error
+
+		for attempt := 0; attempt < maxPortAttempts && port+attempt <= 65535; attempt++ {
+			listeners, err := listenOn(hosts, port+attempt)
+			if err == nil {
+				return listeners, port + attempt, nil
+			}
+
+			if !errors.Is(err, syscall.EADDRINUSE) {
+				return nil, 0, err
+			}
+
+			errs = append(errs, err)
+		}
+
+		return nil, 0, fmt.Errorf("no free port from %v: %w", port, errors.Join(errs...))
+
+	case PORT_FALLBACK_RANDOM:
+		listeners, err := listenOn(hosts, port)
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return listeners, port, err
+		}
+
+		return listenOnRandomPort(hosts)
+
+	default:
+		return nil, 0, fmt.Errorf("unknown port fallback %q", fallback)
+	}
+}
+
+// listenOn binds every host on port, closing
+// them all if any of them fails
+func listenOn(hosts []string, port int) ([]net.Listener, error) {
+	listeners := []net.Listener{}
+
+	for _, host := range hosts {
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+
+		listeners = append(listeners, ln)
+	}
+
+	return listeners, nil
+}
+
+// listenOnRandomPort lets the OS pick a port for the first
+// host and binds the others on the same port
+func listenOnRandomPort(hosts []string) ([]net.Listener, int, error) {
+	var err error
+
+	for attempt := 0; attempt < maxPortAttempts; attempt++ {
+		var first net.Listener
+
+		first, err = net.Listen("tcp", net.JoinHostPort(hosts[0], "0"))
+		if err != nil {
+			return nil, 0, err
+		}
+
+		port := first.Addr().(*net.TCPAddr).Port
+
+		var rest []net.Listener
+
+		rest, err = listenOn(hosts[1:], port)
+		if err == nil {
+			return append([]net.Listener{first}, rest...), port, nil
+		}
+
+		first.Close()
+
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, 0, err
+		}
+	}
+
+	return nil, 0, fmt.Errorf("no free port: %w", err)
+}
+
+// listenedIPs returns the addresses the listeners are bound to, or
+// nil when they accept connections on every address of the machine
+// or on the bind address, which localIps reports as it is
+func listenedIPs(serverConfig *config.ServerConfig, listeners []net.Listener) []string {
+	if serverConfig.Bind != "" {
+		return nil
+	}
+
+	ips := []string{}
+
+	for _, ln := range listeners {
+		addr, ok := ln.Addr().(*net.TCPAddr)
+		if !ok || addr.IP.IsUnspecified() {
+			return nil
+		}
+
+		host, _, _ := net.SplitHostPort(addr.String())
+		ips = append(ips, host)
+	}
+
+	return ips
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, ln := range listeners {
+		ln.Close()
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+)
+
+func TestListen(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name     string
+		bind     string
+		fallback string
+		moved    bool
+		wantErr  error
+	}{
+		{"none", "127.0.0.1", PORT_FALLBACK_NONE, false, syscall.EADDRINUSE},
+		{"next", "127.0.0.1", PORT_FALLBACK_NEXT, true, nil},
+		{"random", "127.0.0.1", PORT_FALLBACK_RANDOM, true, nil},
+		{"next with a missing address", "192.0.2.1", PORT_FALLBACK_NEXT, false, syscall.EADDRNOTAVAIL},
+		{"random with a missing address", "192.0.2.1", PORT_FALLBACK_RANDOM, false, syscall.EADDRNOTAVAIL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listeners, got, err := listen(&config.ServerConfig{
+				Port:         port,
+				Bind:         tt.bind,
+				PortFallback: tt.fallback,
+			})
+			defer closeListeners(listeners)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("listen = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if moved := got != port; moved != tt.moved {
+				t.Errorf("port = %v, configured %v", got, port)
+			}
+		})
+	}
+}
+
+func TestListenSeveralHosts(t *testing.T) {
+	hosts := []string{"127.0.0.1", "127.0.0.2"}
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	for _, fallback := range []string{PORT_FALLBACK_NEXT, PORT_FALLBACK_RANDOM} {
+		t.Run(fallback, func(t *testing.T) {
+			listeners, got, err := listenHosts(hosts, port, fallback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeListeners(listeners)
+
+			if len(listeners) != len(hosts) || got == port {
+				t.Fatalf("bound %v listeners on port %v", len(listeners), got)
+			}
+
+			for i, ln := range listeners {
+				addr := ln.Addr().(*net.TCPAddr)
+				if addr.IP.String() != hosts[i] || addr.Port != got {
+					t.Errorf("listener %v on %v, want %v:%v", i, addr, hosts[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestListenedIPs(t *testing.T) {
+	tests := []struct {
+		name  string
+		bind  string
+		hosts []string
+		want  []string
+	}{
+		{"chosen interfaces", "", []string{"127.0.0.1", "127.0.0.2"}, []string{"127.0.0.1", "127.0.0.2"}},
+		{"every address", "", []string{""}, nil},
+		{"bind address", "localhost", []string{"127.0.0.1"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listeners, _, err := listenHosts(tt.hosts, 0, PORT_FALLBACK_NONE)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeListeners(listeners)
+
+			got := listenedIPs(&config.ServerConfig{Bind: tt.bind}, listeners)
+			if !slices.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("listenedIPs = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/localtunnel/go-localtunnel"
+)
+
+// LocalTunnel tunnels through localtunnel.me or a
+// self-hosted localtunnel-compatible server
+type LocalTunnel struct {
+	// Base URL of the server, localtunnel.me when empty
+	BaseURL string
+
+	// Subdomain to request, random when empty
+	Subdomain string
+
+	listener *localtunnel.Listener
+	done     *tunnelDone
+	mutex    sync.Mutex
+}
+
+func (t *LocalTunnel) Name() string {
+	if t.BaseURL != "" {
+		return TUNNEL_SELFHOSTED
+	}
+
+	return TUNNEL_LOCALTUNNEL
+}
+
+func (t *LocalTunnel) Open(ctx context.Context, localAddr string) (string, error) {
+	listener, err := localtunnel.Listen(localtunnel.Options{
+		BaseURL:   t.BaseURL,
+		Subdomain: t.Subdomain,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	done := newTunnelDone()
+
+	t.mutex.Lock()
+	t.listener = listener
+	t.done = done
+	t.mutex.Unlock()
+
+	go func() {
+		err := acceptAndForward(listener, localAddr)
+		if err == nil || errors.Is(err, localtunnel.ErrListenerClosed) {
+			err = errors.New("tunnel closed")
+		}
+
+		done.finish(err)
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			listener.Close()
+		case <-done.ch:
+		}
+	}()
+
+	return listener.URL(), nil
+}
+
+func (t *LocalTunnel) Wait() error {
+	t.mutex.Lock()
+	done := t.done
+	t.mutex.Unlock()
+
+	if done == nil {
+		return errors.New("tunnel is not open")
+	}
+
+	return done.wait()
+}
+
+func (t *LocalTunnel) Close() error {
+	t.mutex.Lock()
+	listener := t.listener
+	t.mutex.Unlock()
+
+	if listener == nil {
+		return nil
+	}
+
+	return listener.Close()
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/internal/metrics"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+)
+
+// MetricsPath serves the metrics when they are enabled
+const MetricsPath = "/metrics"
+
+// fromLocalNetwork reports whether r was made on the host or by a
+// machine on its local network, rather than through the tunnel
+func fromLocalNetwork(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || isTunnelled(r) {
+		return false
+	}
+
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+}
+
+// localNetworkOnly answers requests from outside the
+// local network, such as through the tunnel, with 403
+func localNetworkOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !fromLocalNetwork(r) {
+			http.Error(w, "Only available on the local network", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serverMetrics are the file server metrics. A nil
+// *serverMetrics records nothing.
+type serverMetrics struct {
+	requests         *metrics.Counter
+	requestDuration  *metrics.Histogram
+	bytesServed      *metrics.Counter
+	bytesUploaded    *metrics.Counter
+	uploads          *metrics.Counter
+	downloads        *metrics.Counter
+	visitors         *metrics.Gauge
+	tunnelUp         *metrics.Gauge
+	tunnelReconnects *metrics.Counter
+}
+
+func newServerMetrics(registry *metrics.Registry) *serverMetrics {
+	m := &serverMetrics{
+		requests:         registry.Counter("snett_http_requests_total", "HTTP requests handled.", "route", "method", "code"),
+		requestDuration:  registry.Histogram("snett_http_request_duration_seconds", "Time taken to handle HTTP requests.", metrics.DefaultBuckets, "route"),
+		bytesServed:      registry.Counter("snett_http_response_bytes_total", "Bytes sent in HTTP responses.", "route"),
+		bytesUploaded:    registry.Counter("snett_uploaded_bytes_total", "Bytes of files uploaded to the served directory."),
+		uploads:          registry.Counter("snett_uploads_total", "Files uploaded to the served directory."),
+		downloads:        registry.Counter("snett_downloads_total", "Downloads of files or archives served."),
+		visitors:         registry.Gauge("snett_websocket_visitors", "Visitors connected to the web UI."),
+		tunnelUp:         registry.Gauge("snett_tunnel_up", "Whether the online tunnel is up.", "provider"),
+		tunnelReconnects: registry.Counter("snett_tunnel_reconnects_total", "Times the online tunnel was re-established.", "provider"),
+	}
+
+	// Expose the unlabelled metrics before anything happens
+	m.bytesUploaded.Add(0)
+	m.uploads.Add(0)
+	m.downloads.Add(0)
+	m.visitors.Set(0)
+
+	return m
+}
+
+// instrument records the requests handled by next under route
+func (m *serverMetrics) instrument(route string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if rec.hijacked {
+			m.requests.Inc(route, r.Method, strconv.Itoa(http.StatusSwitchingProtocols))
+			return
+		}
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		m.requests.Inc(route, r.Method, strconv.Itoa(rec.status))
+		m.requestDuration.Observe(time.Since(start).Seconds(), route)
+		m.bytesServed.Add(float64(rec.written), route)
+	})
+}
+
+// watch updates the metrics from the server events until ctx is done
+func (m *serverMetrics) watch(ctx context.Context, bus *events.Bus) {
+	sub := bus.Subscribe(
+		events.UPLOAD_COMPLETED,
+		events.DOWNLOAD_STARTED,
+		events.VISITOR_JOINED,
+		events.VISITOR_LEFT,
+		events.TUNNEL_UP,
+		events.TUNNEL_DOWN,
+	)
+
+	go func() {
+		<-ctx.Done()
+		sub.Close()
+	}()
+
+	go func() {
+		for envelope := range sub.C() {
+			switch event := envelope.Event.(type) {
+			case events.UploadCompleted:
+				m.uploads.Inc()
+				m.bytesUploaded.Add(float64(event.Size))
+			case events.DownloadStarted:
+				m.downloads.Inc()
+			case events.VisitorJoined:
+				m.visitors.Set(float64(event.Visitors))
+			case events.VisitorLeft:
+				m.visitors.Set(float64(event.Visitors))
+			case events.TunnelUp:
+				m.tunnelUp.Set(1, event.Provider)
+				if event.Reconnects > 0 {
+					m.tunnelReconnects.Inc(event.Provider)
+				}
+			case events.TunnelDown:
+				m.tunnelUp.Set(0, event.Provider)
+			}
+		}
+	}()
+}
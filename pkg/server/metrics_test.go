@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalNetworkOnly(t *testing.T) {
+	tunnelledAddrs.mutex.Lock()
+	tunnelledAddrs.addrs["127.0.0.1:40001"] = struct{}{}
+	tunnelledAddrs.mutex.Unlock()
+
+	t.Cleanup(func() {
+		tunnelledAddrs.mutex.Lock()
+		delete(tunnelledAddrs.addrs, "127.0.0.1:40001")
+		tunnelledAddrs.mutex.Unlock()
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		want       int
+	}{
+		{"loopback", "127.0.0.1:50000", http.StatusOK},
+		{"lan visitor", "192.168.1.20:50000", http.StatusOK},
+		{"ipv6 link-local", "[fe80::1]:50000", http.StatusOK},
+		{"public address", "203.0.113.7:50000", http.StatusForbidden},
+		{"tunnelled", "127.0.0.1:40001", http.StatusForbidden},
+	}
+
+	handler := localNetworkOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, MetricsPath, nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %v, want %v", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/internal/utils"
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+	"github.com/Owbird/SNetT-Engine/pkg/server/handlers"
+	"github.com/grandcat/zeroconf"
+)
+
+// How often the network interfaces are checked for changes
+const networkPollInterval = 5 * time.Second
+
+// localHostURLs formats the local IPs as server URLs
+func localHostURLs(ips []string, port int) []string {
+	hosts := []string{}
+
+	for _, ip := range ips {
+		hosts = append(hosts, utils.HostURL(ip, port))
+	}
+
+	return hosts
+}
+
+// localIps returns the addresses visitors can reach the server on,
+// limited to the chosen interfaces and bind address
+func localIps(serverConfig *config.ServerConfig) ([]string, error) {
+	ips, err := utils.GetLocalIp(serverConfig.Interfaces...)
+	if err != nil || serverConfig.Bind == "" {
+		return ips, err
+	}
+
+	bind, err := netip.ParseAddr(serverConfig.Bind)
+	if err != nil {
+		// A host name such as localhost
+		return []string{serverConfig.Bind}, nil
+	}
+
+	if !bind.IsUnspecified() {
+		return []string{serverConfig.Bind}, nil
+	}
+
+	if bind.Is4() {
+		return slices.DeleteFunc(ips, func(ip string) bool {
+			return strings.Contains(ip, ":")
+		}), nil
+	}
+
+	return ips, nil
+}
+
+// serverIPs ranks the addresses a server was discovered on, IPv4
+// first. IPv6 link-local addresses are skipped, as mDNS does not
+// say which interface they were seen on and they cannot be
+// reached without that zone.
+func serverIPs(ipv4s []net.IP, ipv6s []net.IP) []string {
+	ips := []string{}
+
+	for _, ip := range ipv4s {
+		ips = append(ips, ip.String())
+	}
+
+	for _, ip := range ipv6s {
+		if ip.IsLinkLocalUnicast() {
+			continue
+		}
+
+		ips = append(ips, ip.String())
+	}
+
+	return ips
+}
+
+// listenAddrs returns the addresses to listen on: the bind address,
+// every address of the chosen interfaces, or all interfaces
+func listenAddrs(serverConfig *config.ServerConfig, port int) ([]string, error) {
+	if serverConfig.Bind != "" {
+		return []string{net.JoinHostPort(serverConfig.Bind, strconv.Itoa(port))}, nil
+	}
+
+	if len(serverConfig.Interfaces) == 0 {
+		return []string{net.JoinHostPort("", strconv.Itoa(port))}, nil
+	}
+
+	ips, err := utils.GetLocalIp(serverConfig.Interfaces...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found on interfaces %v", serverConfig.Interfaces)
+	}
+
+	addrs := []string{}
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip, strconv.Itoa(port)))
+	}
+
+	return addrs, nil
+}
+
+// tunnelAddr returns the address the online tunnel forwards to
+func tunnelAddr(serverConfig *config.ServerConfig, port int) string {
+	addrs, err := listenAddrs(serverConfig, port)
+	if err != nil {
+		return net.JoinHostPort("localhost", strconv.Itoa(port))
+	}
+
+	host, _, _ := net.SplitHostPort(addrs[0])
+	if ip, err := netip.ParseAddr(host); host == "" || (err == nil && ip.IsUnspecified()) {
+		return net.JoinHostPort("localhost", strconv.Itoa(port))
+	}
+
+	return addrs[0]
+}
+
+// servedIPs drops the addresses without a listener, such as ones
+// an interface gained after the server started. Addresses are
+// only listened on individually when interfaces are chosen.
+func (s *Server) servedIPs(ips []string) []string {
+	if s.listenedIPs == nil {
+		return ips
+	}
+
+	return slices.DeleteFunc(slices.Clone(ips), func(ip string) bool {
+		return !slices.Contains(s.listenedIPs, ip)
+	})
+}
+
+// registerMdns advertises the server on the local network,
+// replacing any previous registration
+func (s *Server) registerMdns(name string, port int, ifaceNames []string) error {
+	s.mdnsMutex.Lock()
+	defer s.mdnsMutex.Unlock()
+
+	if s.mdns != nil {
+		s.mdns.Shutdown()
+		s.mdns = nil
+	}
+
+	var ifaces []net.Interface
+
+	if len(ifaceNames) > 0 {
+		selected, err := utils.GetInterfaces(ifaceNames...)
+		if err != nil {
+			return err
+		}
+		ifaces = selected
+	}
+
+	var server *zeroconf.Server
+	var err error
+
+	if s.listenedIPs == nil {
+		server, err = zeroconf.Register(name, MdnsServiceName, "local.", port, []string{}, ifaces)
+	} else {
+		server, err = s.registerListenedIPs(name, port, ifaceNames, ifaces)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mdns = server
+
+	return nil
+}
+
+// registerListenedIPs advertises only the addresses
+// of the interfaces that are being listened on
+func (s *Server) registerListenedIPs(name string, port int, ifaceNames []string, ifaces []net.Interface) (*zeroconf.Server, error) {
+	hostName, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := utils.GetLocalIp(ifaceNames...)
+	if err != nil {
+		return nil, err
+	}
+
+	advertised := []string{}
+	for _, ip := range s.servedIPs(ips) {
+		// mDNS records carry no zone
+		ip, _, _ = strings.Cut(ip, "%")
+		advertised = append(advertised, ip)
+	}
+
+	return zeroconf.RegisterProxy(name, MdnsServiceName, "local.", port, hostName, advertised, []string{}, ifaces)
+}
+
+// shutdownMdns stops advertising the server
+func (s *Server) shutdownMdns() {
+	s.mdnsMutex.Lock()
+	defer s.mdnsMutex.Unlock()
+
+	if s.mdns != nil {
+		s.mdns.Shutdown()
+		s.mdns = nil
+	}
+}
+
+// advertising reports whether the server is registered over mDNS
+func (s *Server) advertising() bool {
+	s.mdnsMutex.Lock()
+	defer s.mdnsMutex.Unlock()
+
+	return s.mdns != nil
+}
+
+// watchNetwork follows changes to the network interfaces, such as
+// joining a new Wi-Fi network or a VPN going up or down. The hosts
+// shown to visitors and the mDNS registration are kept up to date,
+// only ever listing addresses that are being listened on.
+func (s *Server) watchNetwork(
+	ctx context.Context,
+	port int,
+	handlerFuncs *handlers.Handlers,
+	ips []string,
+) {
+	ticker := time.NewTicker(networkPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Read through the handlers, as a reload may replace the settings
+		serverConfig := handlerFuncs.Config()
+
+		newIps, err := localIps(&serverConfig)
+		if err != nil {
+			continue
+		}
+
+		// New addresses are only served on after a restart
+		// when the listeners are bound to each address
+		newIps = s.servedIPs(newIps)
+		if slices.Equal(newIps, ips) {
+			continue
+		}
+
+		s.events.Publish(events.Log{Message: fmt.Sprintf("Network changed from %v to %v", ips, newIps)})
+
+		for _, host := range localHostURLs(newIps, port) {
+			if !slices.Contains(handlerFuncs.Hosts(), host) {
+				s.events.Publish(events.ServingURL{URL: host})
+			}
+		}
+
+		ips = newIps
+		handlerFuncs.SetLocalHosts(localHostURLs(ips, port))
+
+		if len(ips) == 0 {
+			s.shutdownMdns()
+
+			s.events.Publish(events.Error{Code: events.ERR_NETWORK, Message: "No network detected"})
+			continue
+		}
+
+		if err := s.registerMdns(serverConfig.Name, port, serverConfig.Interfaces); err != nil {
+			s.events.Publish(events.Error{
+				Code:    events.ERR_MDNS,
+				Message: fmt.Sprintf("Failed to update mDNS registration: %v", err),
+			})
+		}
+	}
+}
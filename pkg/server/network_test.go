@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestServerIPs(t *testing.T) {
+	tests := []struct {
+		name  string
+		ipv4s []string
+		ipv6s []string
+		want  []string
+	}{
+		{"ipv4 first", []string{"192.168.1.5"}, []string{"fd00::5"}, []string{"192.168.1.5", "fd00::5"}},
+		{"link-local skipped", nil, []string{"fe80::1", "fd00::5"}, []string{"fd00::5"}},
+		{"only link-local", nil, []string{"fe80::1"}, []string{}},
+	}
+
+	parse := func(ips []string) []net.IP {
+		parsed := []net.IP{}
+		for _, ip := range ips {
+			parsed = append(parsed, net.ParseIP(ip))
+		}
+		return parsed
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serverIPs(parse(tt.ipv4s), parse(tt.ipv6s)); !slices.Equal(got, tt.want) {
+				t.Errorf("serverIPs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServedIPs(t *testing.T) {
+	tests := []struct {
+		name     string
+		listened []string
+		ips      []string
+		want     []string
+	}{
+		{"every address", nil, []string{"192.168.1.5", "10.8.0.2"}, []string{"192.168.1.5", "10.8.0.2"}},
+		{"new address without a listener", []string{"192.168.1.5"}, []string{"192.168.1.5", "10.8.0.2"}, []string{"192.168.1.5"}},
+		{"address gone", []string{"192.168.1.5", "10.8.0.2"}, []string{"10.8.0.2"}, []string{"10.8.0.2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{listenedIPs: tt.listened}
+
+			if got := s.servedIPs(tt.ips); !slices.Equal(got, tt.want) {
+				t.Errorf("servedIPs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
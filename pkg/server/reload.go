@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+	"github.com/Owbird/SNetT-Engine/pkg/server/handlers"
+)
+
+// liveSettings are the settings applied to a running server
+// when they change in snett.toml. Others need a restart.
+var liveSettings = map[string]func(updated *config.AppConfig, serverConfig *config.ServerConfig, notifConfig *config.NotifConfig){
+	"server.name": func(updated *config.AppConfig, serverConfig *config.ServerConfig, notifConfig *config.NotifConfig) {
+		serverConfig.Name = updated.Server.Name
+	},
+	"server.allowUploads": func(updated *config.AppConfig, serverConfig *config.ServerConfig, notifConfig *config.NotifConfig) {
+		serverConfig.AllowUploads = updated.Server.AllowUploads
+	},
+	"server.approveUploads": func(updated *config.AppConfig, serverConfig *config.ServerConfig, notifConfig *config.NotifConfig) {
+		serverConfig.ApproveUploads = updated.Server.ApproveUploads
+	},
+	"server.limits": func(updated *config.AppConfig, serverConfig *config.ServerConfig, notifConfig *config.NotifConfig) {
+		serverConfig.Limits = updated.Server.Limits
+	},
+	"notification.allowNotif": func(updated *config.AppConfig, serverConfig *config.ServerConfig, notifConfig *config.NotifConfig) {
+		notifConfig.AllowNotif = updated.Notification.AllowNotif
+	},
+	"notification.notifiers": func(updated *config.AppConfig, serverConfig *config.ServerConfig, notifConfig *config.NotifConfig) {
+		notifConfig.Notifiers = updated.Notification.Notifiers
+	},
+	"notification.clipboard": func(updated *config.AppConfig, serverConfig *config.ServerConfig, notifConfig *config.NotifConfig) {
+		notifConfig.Clipboard = updated.Notification.Clipboard
+	},
+	"notification.push": func(updated *config.AppConfig, serverConfig *config.ServerConfig, notifConfig *config.NotifConfig) {
+		notifConfig.Push = updated.Notification.Push
+	},
+}
+
+// watchConfig applies changes to snett.toml while the server runs.
+// Only the settings changed in the file are applied, so those
+// given on the command line are kept otherwise.
+func (s *Server) watchConfig(port int, handlerFuncs *handlers.Handlers) {
+	err := s.appConfig.Watch(func(previous *config.AppConfig, updated *config.AppConfig, err error) {
+		if err != nil {
+			s.events.Publish(events.Error{
+				Code:    events.ERR_CONFIG,
+				Message: fmt.Sprintf("Ignoring the changes to %v: %v", s.appConfig.Path(), err),
+			})
+			return
+		}
+
+		s.reloadConfig(previous, updated, port, handlerFuncs)
+	})
+
+	if errors.Is(err, config.ErrNoConfigFile) {
+		return
+	}
+
+	if err != nil {
+		s.events.Publish(events.Error{
+			Code:    events.ERR_CONFIG,
+			Message: fmt.Sprintf("Failed to watch %v: %v", s.appConfig.Path(), err),
+		})
+	}
+}
+
+// reloadConfig applies the settings that changed from previous to updated
+func (s *Server) reloadConfig(previous *config.AppConfig, updated *config.AppConfig, port int, handlerFuncs *handlers.Handlers) {
+	changed := previous.Changed(updated)
+	if len(changed) == 0 {
+		return
+	}
+
+	serverConfig := handlerFuncs.Config()
+	notifConfig := handlerFuncs.NotifConfig()
+
+	reloaded := events.ConfigReloaded{}
+
+	for _, key := range changed {
+		// A profile change shows up in the settings it overrides
+		if key == "profile" || strings.HasPrefix(key, "profiles.") {
+			continue
+		}
+
+		apply, ok := liveSettings[key]
+		if !ok && strings.HasPrefix(key, "notification.push.") {
+			apply, ok = liveSettings["notification.push"]
+		}
+
+		if !ok && strings.HasPrefix(key, "server.limits.") {
+			apply, ok = liveSettings["server.limits"]
+		}
+
+		if !ok {
+			reloaded.Restart = append(reloaded.Restart, key)
+			continue
+		}
+
+		apply(updated, &serverConfig, &notifConfig)
+		reloaded.Applied = append(reloaded.Applied, key)
+	}
+
+	if len(reloaded.Applied) == 0 && len(reloaded.Restart) == 0 {
+		return
+	}
+
+	if len(reloaded.Applied) > 0 {
+		nameChanged := serverConfig.Name != handlerFuncs.Config().Name
+
+		handlerFuncs.SetConfig(serverConfig, notifConfig)
+
+		if nameChanged && s.advertising() {
+			if err := s.registerMdns(serverConfig.Name, port, serverConfig.Interfaces); err != nil {
+				s.events.Publish(events.Error{
+					Code:    events.ERR_MDNS,
+					Message: fmt.Sprintf("Failed to update mDNS registration: %v", err),
+				})
+			}
+		}
+	}
+
+	s.events.Publish(reloaded)
+}
@@ -4,20 +4,24 @@ package server
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/Owbird/SNetT-Engine/internal/logger"
-	"github.com/Owbird/SNetT-Engine/internal/utils"
+	"github.com/Owbird/SNetT-Engine/internal/metrics"
 	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+	"github.com/Owbird/SNetT-Engine/pkg/hooks"
 	"github.com/Owbird/SNetT-Engine/pkg/models"
 	"github.com/Owbird/SNetT-Engine/pkg/server/handlers"
 	"github.com/gorilla/websocket"
 	"github.com/grandcat/zeroconf"
-	"github.com/localtunnel/go-localtunnel"
 	"github.com/rs/cors"
 )
 
@@ -25,98 +29,238 @@ type Server struct {
 	// The current directory being hosted
 	Dir string
 
-	// The channel to send the logs through
-	logCh chan models.ServerLog
+	// The logger used by the server
+	Logger *slog.Logger
+
+	// The app configuration the server starts with
+	appConfig *config.AppConfig
+
+	// The bus the server events are published on
+	events *events.Bus
+
+	// Delivers the events to the log channel
+	logs     *events.Subscription
+	logsDone chan struct{}
+
+	// Closed when the log channel is no longer waited on
+	logsStop     chan struct{}
+	logsStopOnce sync.Once
+
+	// The mDNS registration of the server
+	mdns      *zeroconf.Server
+	mdnsMutex sync.Mutex
+
+	// The addresses listened on when interfaces are chosen,
+	// nil when listening on every address or the bind address
+	listenedIPs []string
+
+	// The handlers of the running server
+	handlerFuncs atomic.Pointer[handlers.Handlers]
 }
 
-func NewServer(dir string, logCh chan models.ServerLog) *Server {
-	return &Server{
-		Dir:   dir,
-		logCh: logCh,
+// NewServer returns a server for dir using appConfig, or the default
+// configuration when appConfig is nil. The server events are sent
+// through logCh as ServerLogs, or written to the server Logger when
+// logCh is nil. A slow consumer never blocks the server: events
+// it falls too far behind on are written to the Logger instead.
+func NewServer(dir string, appConfig *config.AppConfig, logCh chan models.ServerLog) *Server {
+	if appConfig == nil {
+		appConfig = config.Default()
 	}
+
+	bus := events.NewBus()
+
+	s := &Server{
+		Dir:       dir,
+		Logger:    logger.Logger,
+		appConfig: appConfig,
+		events:    bus,
+		logsDone:  make(chan struct{}),
+		logsStop:  make(chan struct{}),
+	}
+
+	s.logs = bus.SubscribeWithOverflow(s.logEvent)
+
+	go func() {
+		defer close(s.logsDone)
+
+		if logCh != nil {
+			events.ForwardServerLogs(s.logs, logCh, s.logsStop, s.logEvent)
+			return
+		}
+
+		for envelope := range s.logs.C() {
+			s.logEvent(envelope)
+		}
+	}()
+
+	return s
+}
+
+// LOG_FLUSH_TIMEOUT is how long flushLogs waits for the
+// consumer of the log channel to receive the pending events
+const LOG_FLUSH_TIMEOUT = 2 * time.Second
+
+// flushLogs delivers the pending events to the log channel
+// and stops sending to it, so the channel can be closed. The
+// events the consumer does not receive in time are written
+// to the Logger instead.
+func (s *Server) flushLogs() {
+	s.logs.Close()
+
+	timer := time.NewTimer(LOG_FLUSH_TIMEOUT)
+	defer timer.Stop()
+
+	select {
+	case <-s.logsDone:
+		return
+	case <-timer.C:
+	}
+
+	s.logsStopOnce.Do(func() {
+		close(s.logsStop)
+	})
+
+	<-s.logsDone
+}
+
+// DroppedLogs returns how many events could not be sent through
+// the log channel because its consumer fell behind
+func (s *Server) DroppedLogs() uint64 {
+	return s.logs.Dropped()
+}
+
+// logEvent writes an event to the server Logger
+func (s *Server) logEvent(envelope events.Envelope) {
+	serverLog := envelope.Event.ServerLog()
+
+	switch serverLog.Type {
+	case models.SERVER_ERROR:
+		s.Logger.Error("Server Error", "value", serverLog.Value)
+	case models.TUNNEL_DOWN:
+		s.Logger.Warn("Tunnel Down", "value", serverLog.Value)
+	default:
+		s.Logger.Info("Server Log", "type", serverLog.Type, "value", serverLog.Value)
+	}
+}
+
+// Events returns the bus the server events are published on
+func (s *Server) Events() *events.Bus {
+	return s.events
 }
 
 const MdnsServiceName = "_snett._tcp"
 
 // Starts starts and serves the specified dir
-func (s *Server) Start(tempConfig config.AppConfig) {
-	serverConfig := tempConfig.GetSeverConfig()
-	notifConfig := tempConfig.GetNotifConfig()
+func (s *Server) Start() {
+	serverConfig := s.appConfig.GetSeverConfig()
 
-	port := serverConfig.Port
+	defer s.flushLogs()
 
-	s.logCh <- models.ServerLog{
-		Value: "Starting server",
-		Type:  models.API_LOG,
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Closed before cancel so the hooks of the last events can finish
+	serverHooks := hooks.NewHooks(s.appConfig.GetHooksConfig(), s.Logger)
+	serverHooks.Listen(ctx, s.events)
+	defer serverHooks.Close()
 
-	hosts, err := utils.GetLocalIp()
+	s.events.Publish(events.Log{Message: "Starting server"})
+
+	hosts, err := localIps(serverConfig)
 	if err != nil {
-		s.logCh <- models.ServerLog{
-			Value: err.Error(),
-			Type:  models.SERVER_ERROR,
-		}
+		s.events.Publish(events.Error{Code: events.ERR_NETWORK, Message: err.Error()})
 		return
 	}
 
 	if len(hosts) == 0 {
-		s.logCh <- models.ServerLog{
-			Value: "No network detected",
-			Type:  models.SERVER_ERROR,
-		}
+		s.events.Publish(events.Error{Code: events.ERR_NETWORK, Message: "No network detected"})
 		return
 
 	}
 
-	server, err := zeroconf.Register(serverConfig.Name, MdnsServiceName, "local.", port, []string{}, nil)
+	handlerFuncs, err := handlers.NewHandlers(s.events, s.Logger, s.Dir, s.appConfig)
 	if err != nil {
-		s.logCh <- models.ServerLog{
-			Value: err.Error(),
-			Type:  models.SERVER_ERROR,
-		}
+		s.events.Publish(events.Error{
+			Code:    events.ERR_SERVE,
+			Message: fmt.Sprintf("Failed to load the web UI: %v", err),
+		})
 		return
 	}
+	s.handlerFuncs.Store(handlerFuncs)
 
-	handlerFuncs := handlers.NewHandlers(s.logCh, s.Dir, tempConfig.GetSeverConfig(), tempConfig.GetNotifConfig())
+	// Bind before advertising so the logs, hosts and mDNS
+	// record all carry the port actually being served on
+	listeners, port, err := listen(serverConfig)
+	if err != nil {
+		s.events.Publish(events.Error{
+			Code:    events.ERR_LISTEN,
+			Message: fmt.Sprintf("Failed to listen on port %v: %v", serverConfig.Port, err),
+		})
+		return
+	}
 
-	go handlerFuncs.WatchFiles()
+	if port != serverConfig.Port {
+		s.events.Publish(events.Log{
+			Message: fmt.Sprintf("Port %v is in use, serving on port %v", serverConfig.Port, port),
+		})
+	}
 
-	for _, host := range hosts {
+	s.listenedIPs = listenedIPs(serverConfig, listeners)
 
-		fmtedHost := fmt.Sprintf("http://%s:%d", host, port)
+	err = s.registerMdns(serverConfig.Name, port, serverConfig.Interfaces)
+	if err != nil {
+		closeListeners(listeners)
+		s.events.Publish(events.Error{Code: events.ERR_MDNS, Message: err.Error()})
+		return
+	}
 
-		s.logCh <- models.ServerLog{
-			Value: fmtedHost,
-			Type:  models.SERVE_UI_LOCAL,
-		}
+	if err := handlerFuncs.LoadQuarantine(); err != nil {
+		s.Logger.Warn("Failed to restore the uploads waiting for approval", "err", err)
+	}
 
-		handlerFuncs.Hosts = append(handlerFuncs.Hosts, fmtedHost)
+	accessLog, err := openAccessLog(s.appConfig.GetLogConfig())
+	if err != nil {
+		s.events.Publish(events.Error{
+			Code:    events.ERR_LOG,
+			Message: fmt.Sprintf("Failed to open the access log: %v", err),
+		})
 	}
 
-	if serverConfig.AllowOnline {
-		go (func() {
-			tunnel, err := localtunnel.New(port, "localhost", localtunnel.Options{})
-			if err != nil {
-				s.logCh <- models.ServerLog{
-					Value: err.Error(),
-					Type:  models.SERVE_UI_REMOTE,
-				}
-				return
-			}
+	var serverMetrics *serverMetrics
+	var metricsRegistry *metrics.Registry
 
-			notifConfig.SendNotification(models.Notification{
-				Title:         "Web Server Ready",
-				Body:          "URL copied to clipboard",
-				ClipboardText: tunnel.URL(),
-			})
+	if serverConfig.Metrics {
+		metricsRegistry = metrics.NewRegistry()
+		serverMetrics = newServerMetrics(metricsRegistry)
 
-			handlerFuncs.Hosts = append(handlerFuncs.Hosts, tunnel.URL())
+		handlerFuncs.RegisterMetrics(metricsRegistry)
+		serverMetrics.watch(ctx, s.events)
+	}
 
-			s.logCh <- models.ServerLog{
-				Value: tunnel.URL(),
-				Type:  models.SERVE_UI_REMOTE,
-			}
-		})()
+	go handlerFuncs.WatchFiles()
+
+	localHosts := localHostURLs(hosts, port)
+
+	for _, host := range localHosts {
+		s.events.Publish(events.ServingURL{URL: host})
+	}
+
+	handlerFuncs.SetLocalHosts(localHosts)
+
+	go s.watchNetwork(ctx, port, handlerFuncs, hosts)
+
+	s.watchConfig(port, handlerFuncs)
+
+	if serverConfig.AllowOnline {
+		tunnel, err := NewTunnel(s.appConfig.GetTunnelConfig())
+		if err != nil {
+			s.events.Publish(events.Error{Code: events.ERR_TUNNEL, Message: err.Error()})
+		} else {
+			handlerFuncs.TrustForwardedFor(forwardsVisitorAddr(s.appConfig.GetTunnelConfig()))
+
+			go s.runTunnel(ctx, tunnel, tunnelAddr(serverConfig, port), handlerFuncs)
+		}
 	}
 
 	go func() {
@@ -124,14 +268,27 @@ func (s *Server) Start(tempConfig config.AppConfig) {
 
 		mux := http.NewServeMux()
 
-		mux.HandleFunc("/", handlerFuncs.IndexHandler)
-		mux.HandleFunc("/connect", func(w http.ResponseWriter, r *http.Request) {
+		handle := func(pattern string, handler http.HandlerFunc) {
+			mux.Handle(pattern, serverMetrics.instrument(pattern, handler))
+		}
+
+		handle("/", handlerFuncs.IndexHandler)
+		handle("/connect", func(w http.ResponseWriter, r *http.Request) {
 			handlerFuncs.HandleConnect(&upgrader, w, r)
 		})
-		mux.HandleFunc("/download", handlerFuncs.DownloadFileHandler)
-		mux.HandleFunc("/view", handlerFuncs.ViewFileHandler)
-		mux.HandleFunc("/upload", handlerFuncs.GetFileUpload)
-		mux.HandleFunc("GET /assets/{file}", handlerFuncs.GetAssets)
+		handle("/download", handlerFuncs.DownloadFileHandler)
+		handle("/view", handlerFuncs.ViewFileHandler)
+		handle("/upload", handlerFuncs.GetFileUpload)
+		handle("GET /assets/{file}", handlerFuncs.GetAssets)
+		handle("GET /api/v1/qr", handlerFuncs.QRHandler)
+		handle("GET "+HealthPath, handlerFuncs.HealthHandler)
+		handle("GET "+UploadsPath, hostOnly(s.pendingUploadsHandler))
+		handle("POST "+UploadsPath+"/{id}/approve", hostOnly(s.decideUploadHandler(true)))
+		handle("POST "+UploadsPath+"/{id}/reject", hostOnly(s.decideUploadHandler(false)))
+
+		if metricsRegistry != nil {
+			mux.Handle("GET "+MetricsPath, localNetworkOnly(metricsRegistry.Handler()))
+		}
 
 		corsOpts := cors.New(cors.Options{
 			AllowedOrigins: []string{"*"},
@@ -146,18 +303,22 @@ func (s *Server) Start(tempConfig config.AppConfig) {
 			},
 		})
 
-		s.logCh <- models.ServerLog{
-			Value: fmt.Sprintf("Starting API from %v", s.Dir),
-			Type:  models.API_LOG,
+		s.events.Publish(events.Log{Message: fmt.Sprintf("Starting API from %v", s.Dir)})
+
+		errCh := make(chan error, len(listeners))
+
+		for _, ln := range listeners {
+			go func() {
+				errCh <- http.Serve(ln, accessLog.wrap(corsOpts.Handler(mux)))
+			}()
 		}
 
-		err = http.ListenAndServe(fmt.Sprintf(":%v", port), corsOpts.Handler(mux))
+		err := <-errCh
 		if err != nil {
-			s.logCh <- models.ServerLog{
-				Value: err.Error(),
-				Type:  models.SERVER_ERROR,
-			}
-			logger.Logger.Error("ListenAndServe error", "err", err)
+			s.events.Publish(events.Error{Code: events.ERR_SERVE, Message: err.Error()})
+			s.Logger.Error("Serve error", "err", err)
+			serverHooks.Close()
+			s.flushLogs()
 			os.Exit(1)
 		}
 	}()
@@ -166,22 +327,23 @@ func (s *Server) Start(tempConfig config.AppConfig) {
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 	<-sig
 
-	server.Shutdown()
+	s.shutdownMdns()
 
-	s.logCh <- models.ServerLog{
-		Value: "Shutting down",
-		Type:  models.API_LOG,
-	}
+	s.events.Publish(events.Log{Message: "Shutting down"})
+	serverHooks.Close()
+
+	cancel()
+	s.flushLogs()
 
 	os.Exit(0)
 }
 
 // List shows the broadcasted servers on the network
 func (s *Server) List(servers chan<- models.SNetTServer) {
-	logger.Logger.Info("Scanning...")
+	s.Logger.Info("Scanning...")
 	resolver, err := zeroconf.NewResolver(nil)
 	if err != nil {
-		logger.Logger.Error("Failed to initialize resolver", "err", err)
+		s.Logger.Error("Failed to initialize resolver", "err", err)
 		os.Exit(1)
 	}
 	defer close(servers)
@@ -192,8 +354,17 @@ func (s *Server) List(servers chan<- models.SNetTServer) {
 			server := models.SNetTServer{
 				Name: entry.Instance,
 				Port: entry.Port,
-				IP:   entry.AddrIPv4[0].String(),
+				IPs:  []string{},
 			}
+
+			server.IPs = append(server.IPs, serverIPs(entry.AddrIPv4, entry.AddrIPv6)...)
+
+			if len(server.IPs) == 0 {
+				continue
+			}
+
+			server.IP = server.IPs[0]
+
 			servers <- server
 		}
 	}(entries)
@@ -203,7 +374,7 @@ func (s *Server) List(servers chan<- models.SNetTServer) {
 
 	err = resolver.Browse(ctx, MdnsServiceName, "local.", entries)
 	if err != nil {
-		logger.Logger.Error("Failed to browse", "err", err)
+		s.Logger.Error("Failed to browse", "err", err)
 		os.Exit(1)
 	}
 
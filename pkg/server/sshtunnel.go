@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHTunnel exposes the server through a reverse
+// tunnel on an SSH server, like ssh -R
+type SSHTunnel struct {
+	Config config.SSHTunnelConfig
+
+	client *ssh.Client
+	done   *tunnelDone
+	mutex  sync.Mutex
+}
+
+func (t *SSHTunnel) Name() string {
+	return TUNNEL_SSH
+}
+
+func (t *SSHTunnel) Open(ctx context.Context, localAddr string) (string, error) {
+	clientConfig, closeAgent, err := t.clientConfig()
+	if err != nil {
+		return "", err
+	}
+	defer closeAgent()
+
+	dialer := net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "tcp", t.Config.Address)
+	if err != nil {
+		return "", err
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, t.Config.Address, clientConfig)
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	remoteAddr := net.JoinHostPort(t.Config.RemoteHost, fmt.Sprint(t.Config.RemotePort))
+
+	listener, err := client.Listen("tcp", remoteAddr)
+	if err != nil {
+		client.Close()
+		return "", fmt.Errorf("failed to listen on %v: %w", remoteAddr, err)
+	}
+
+	done := newTunnelDone()
+
+	t.mutex.Lock()
+	t.client = client
+	t.done = done
+	t.mutex.Unlock()
+
+	go func() {
+		done.finish(acceptAndForward(listener, localAddr))
+	}()
+
+	go func() {
+		err := client.Wait()
+		if err == nil {
+			err = errors.New("ssh connection closed")
+		}
+
+		done.finish(err)
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-done.ch:
+			client.Close()
+		}
+	}()
+
+	return t.publicURL(), nil
+}
+
+func (t *SSHTunnel) Wait() error {
+	t.mutex.Lock()
+	done := t.done
+	t.mutex.Unlock()
+
+	if done == nil {
+		return errors.New("tunnel is not open")
+	}
+
+	return done.wait()
+}
+
+func (t *SSHTunnel) Close() error {
+	t.mutex.Lock()
+	client := t.client
+	t.mutex.Unlock()
+
+	if client == nil {
+		return nil
+	}
+
+	return client.Close()
+}
+
+// publicURL returns the configured URL visitors use, or
+// one derived from the SSH server and remote port
+func (t *SSHTunnel) publicURL() string {
+	if t.Config.PublicURL != "" {
+		return t.Config.PublicURL
+	}
+
+	host, _, err := net.SplitHostPort(t.Config.Address)
+	if err != nil {
+		host = t.Config.Address
+	}
+
+	return fmt.Sprintf("http://%v", net.JoinHostPort(host, fmt.Sprint(t.Config.RemotePort)))
+}
+
+// clientConfig returns the SSH client configuration and a
+// func to release the SSH agent once the handshake is done
+func (t *SSHTunnel) clientConfig() (*ssh.ClientConfig, func(), error) {
+	user := t.Config.User
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+
+	hostKeyCallback, err := t.hostKeyCallback()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auth, closeAgent, err := t.authMethod()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}, closeAgent, nil
+}
+
+// authMethod uses the configured key file,
+// falling back to the SSH agent
+func (t *SSHTunnel) authMethod() (ssh.AuthMethod, func(), error) {
+	if t.Config.KeyFile != "" {
+		key, err := os.ReadFile(expandHome(t.Config.KeyFile))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read ssh key: %w", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse ssh key: %w", err)
+		}
+
+		return ssh.PublicKeys(signer), func() {}, nil
+	}
+
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, errors.New("tunnel.ssh.keyFile is not set and no ssh agent is running")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh agent: %w", err)
+	}
+
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), func() { conn.Close() }, nil
+}
+
+// hostKeyCallback verifies the server against the
+// configured or default known_hosts file
+func (t *SSHTunnel) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	knownHostsFile := t.Config.KnownHostsFile
+	if knownHostsFile == "" {
+		knownHostsFile = "~/.ssh/known_hosts"
+	}
+
+	callback, err := knownhosts.New(expandHome(knownHostsFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts: %w", err)
+	}
+
+	return callback, nil
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+}
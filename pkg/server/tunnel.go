@@ -0,0 +1,370 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+	"github.com/Owbird/SNetT-Engine/pkg/server/handlers"
+)
+
+const (
+	// Tunnel providers selectable in snett.toml
+	TUNNEL_LOCALTUNNEL = "localtunnel"
+	TUNNEL_SELFHOSTED  = "selfhosted"
+	TUNNEL_SSH         = "ssh"
+)
+
+const (
+	// Delay before the first reconnect attempt
+	tunnelMinBackoff = 2 * time.Second
+
+	// Longest delay between reconnect attempts
+	tunnelMaxBackoff = 2 * time.Minute
+
+	// How often the public URL is checked
+	tunnelHealthInterval = 30 * time.Second
+
+	// How long a health check may take
+	tunnelHealthTimeout = 10 * time.Second
+
+	// Failed health checks in a row before the
+	// tunnel is considered down
+	tunnelHealthFailures = 3
+)
+
+// HealthPath is checked through the tunnel to make sure
+// the public URL still reaches this server
+const HealthPath = "/api/v1/health"
+
+// Tunnel exposes the local file server on a public URL
+type Tunnel interface {
+	// Name identifies the provider in logs
+	Name() string
+
+	// Open establishes the tunnel to the local address
+	// and returns the public URL
+	Open(ctx context.Context, localAddr string) (string, error)
+
+	// Wait blocks until the open tunnel goes down
+	// and returns the reason
+	Wait() error
+
+	// Close tears down the open tunnel
+	Close() error
+}
+
+// NewTunnel returns the tunnel provider selected in the configuration
+func NewTunnel(tunnelConfig *config.TunnelConfig) (Tunnel, error) {
+	if tunnelConfig == nil {
+		return &LocalTunnel{}, nil
+	}
+
+	switch tunnelConfig.Provider {
+	case "", TUNNEL_LOCALTUNNEL:
+		return &LocalTunnel{
+			Subdomain: tunnelConfig.Subdomain,
+		}, nil
+
+	case TUNNEL_SELFHOSTED:
+		if tunnelConfig.Host == "" {
+			return nil, fmt.Errorf("tunnel.host is required for the %v tunnel", TUNNEL_SELFHOSTED)
+		}
+
+		return &LocalTunnel{
+			BaseURL:   tunnelConfig.Host,
+			Subdomain: tunnelConfig.Subdomain,
+		}, nil
+
+	case TUNNEL_SSH:
+		if tunnelConfig.SSH == nil || tunnelConfig.SSH.Address == "" {
+			return nil, fmt.Errorf("tunnel.ssh.address is required for the %v tunnel", TUNNEL_SSH)
+		}
+
+		return &SSHTunnel{
+			Config: *tunnelConfig.SSH,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown tunnel provider %q", tunnelConfig.Provider)
+	}
+}
+
+// forwardsVisitorAddr reports whether the tunnel provider appends
+// the address of the visitor to X-Forwarded-For. The loca.lt proxy
+// does, while self-hosted servers may not and the SSH tunnel
+// forwards raw connections.
+func forwardsVisitorAddr(tunnelConfig *config.TunnelConfig) bool {
+	return tunnelConfig == nil || tunnelConfig.Provider == "" || tunnelConfig.Provider == TUNNEL_LOCALTUNNEL
+}
+
+// acceptAndForward forwards every connection accepted on ln to
+// localAddr until ln fails, returning the error it failed with
+func acceptAndForward(ln net.Listener, localAddr string) error {
+	for {
+		remoteConn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+
+		go forward(remoteConn, localAddr)
+	}
+}
+
+// tunnelledAddrs are the addresses the tunnelled connections come
+// from as seen by the local server. They arrive from the loopback
+// address like the host's own requests, so they are told apart
+// by these.
+var tunnelledAddrs = struct {
+	addrs map[string]struct{}
+	mutex sync.RWMutex
+}{addrs: make(map[string]struct{})}
+
+// isTunnelled reports whether r came through the tunnel
+func isTunnelled(r *http.Request) bool {
+	tunnelledAddrs.mutex.RLock()
+	defer tunnelledAddrs.mutex.RUnlock()
+
+	_, found := tunnelledAddrs.addrs[r.RemoteAddr]
+
+	return found
+}
+
+// forward pipes a tunnelled connection to the local server
+func forward(remoteConn net.Conn, localAddr string) {
+	localConn, err := net.Dial("tcp", localAddr)
+	if err != nil {
+		remoteConn.Close()
+		return
+	}
+
+	addr := localConn.LocalAddr().String()
+
+	tunnelledAddrs.mutex.Lock()
+	tunnelledAddrs.addrs[addr] = struct{}{}
+	tunnelledAddrs.mutex.Unlock()
+
+	defer func() {
+		tunnelledAddrs.mutex.Lock()
+		delete(tunnelledAddrs.addrs, addr)
+		tunnelledAddrs.mutex.Unlock()
+	}()
+
+	go func() {
+		io.Copy(remoteConn, localConn)
+		remoteConn.Close()
+	}()
+
+	io.Copy(localConn, remoteConn)
+	localConn.Close()
+}
+
+// nextBackoff doubles the reconnect delay up to tunnelMaxBackoff
+func nextBackoff(backoff time.Duration) time.Duration {
+	return min(backoff*2, tunnelMaxBackoff)
+}
+
+// withJitter spreads reconnect attempts between half
+// and all of the backoff
+func withJitter(backoff time.Duration) time.Duration {
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// runTunnel keeps the online tunnel open. It watches the public
+// URL and re-establishes the tunnel with backoff when it goes down,
+// keeping the hosts and the clipboard up to date. The host is only
+// notified again when a reconnect brings a different URL.
+func (s *Server) runTunnel(
+	ctx context.Context,
+	tunnel Tunnel,
+	localAddr string,
+	handlerFuncs *handlers.Handlers,
+) {
+	backoff := tunnelMinBackoff
+	reconnects := -1
+	lastURL := ""
+
+	for ctx.Err() == nil {
+		url, err := tunnel.Open(ctx, localAddr)
+		if err != nil {
+			s.events.Publish(events.Error{
+				Code:    events.ERR_TUNNEL,
+				Message: fmt.Sprintf("Failed to open %v tunnel: %v", tunnel.Name(), err),
+			})
+		} else {
+			backoff = tunnelMinBackoff
+			reconnects++
+
+			if url != lastURL {
+				body := "URL copied to clipboard"
+				if lastURL != "" {
+					body = "The URL changed, the new one was copied to the clipboard"
+				}
+
+				// Notifiers may run commands or reach push servers,
+				// which must not hold up serving through the tunnel
+				notifConfig := handlerFuncs.NotifConfig()
+				go notifConfig.SendNotification(s.Logger, models.Notification{
+					Title:         "Web Server Ready",
+					Body:          body,
+					ClipboardText: url,
+				})
+
+				lastURL = url
+			}
+
+			handlerFuncs.AddRemoteHost(url)
+
+			s.events.Publish(events.ServingURL{URL: url, Remote: true})
+
+			s.events.Publish(events.TunnelUp{TunnelEvent: models.TunnelEvent{
+				Provider:   tunnel.Name(),
+				URL:        url,
+				Reconnects: reconnects,
+				Time:       time.Now(),
+			}})
+
+			err = s.superviseTunnel(ctx, tunnel, url)
+
+			handlerFuncs.RemoveRemoteHost(url)
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			s.events.Publish(events.TunnelDown{TunnelEvent: models.TunnelEvent{
+				Provider:   tunnel.Name(),
+				URL:        url,
+				Error:      err.Error(),
+				Reconnects: reconnects,
+				Time:       time.Now(),
+			}})
+		}
+
+		delay := withJitter(backoff)
+
+		s.events.Publish(events.TunnelStatus{
+			Provider: tunnel.Name(),
+			Message:  fmt.Sprintf("Reconnecting %v tunnel in %v", tunnel.Name(), delay.Round(time.Second)),
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		backoff = nextBackoff(backoff)
+	}
+}
+
+// superviseTunnel waits for the open tunnel to go down, closing it
+// if the public URL stops passing health checks
+func (s *Server) superviseTunnel(ctx context.Context, tunnel Tunnel, url string) error {
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- tunnel.Wait()
+	}()
+
+	ticker := time.NewTicker(tunnelHealthInterval)
+	defer ticker.Stop()
+
+	client := &http.Client{
+		Timeout: tunnelHealthTimeout,
+	}
+
+	failures := 0
+
+	for {
+		select {
+		case <-ctx.Done():
+			tunnel.Close()
+			return ctx.Err()
+
+		case err := <-waitErr:
+			return err
+
+		case <-ticker.C:
+			err := checkTunnelHealth(ctx, client, url)
+			if err == nil {
+				failures = 0
+				continue
+			}
+
+			failures++
+
+			s.events.Publish(events.TunnelStatus{
+				Provider: tunnel.Name(),
+				Message:  fmt.Sprintf("%v tunnel health check failed (%v/%v): %v", tunnel.Name(), failures, tunnelHealthFailures, err),
+			})
+
+			if failures >= tunnelHealthFailures {
+				tunnel.Close()
+				<-waitErr
+
+				return fmt.Errorf("health check failed: %w", err)
+			}
+		}
+	}
+}
+
+// checkTunnelHealth makes sure the public URL reaches this server
+func checkTunnelHealth(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(url, "/")+HealthPath, nil)
+	if err != nil {
+		return err
+	}
+
+	// Skip the localtunnel reminder page
+	req.Header.Set("Bypass-Tunnel-Reminder", "true")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %v", res.Status)
+	}
+
+	return nil
+}
+
+// tunnelDone records why an open tunnel went down
+type tunnelDone struct {
+	ch   chan struct{}
+	err  error
+	once sync.Once
+}
+
+func newTunnelDone() *tunnelDone {
+	return &tunnelDone{
+		ch: make(chan struct{}),
+	}
+}
+
+// finish marks the tunnel as down. Only the first reason is kept.
+func (d *tunnelDone) finish(err error) {
+	d.once.Do(func() {
+		d.err = err
+		close(d.ch)
+	})
+}
+
+func (d *tunnelDone) wait() error {
+	<-d.ch
+
+	return d.err
+}
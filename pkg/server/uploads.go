@@ -0,0 +1,41 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/Owbird/SNetT-Engine/pkg/server/handlers"
+)
+
+// ErrNotStarted is returned when managing a server
+// that has not started serving yet
+var ErrNotStarted = errors.New("server has not started")
+
+// PendingUploads returns the uploads waiting for approval, oldest first
+func (s *Server) PendingUploads() []handlers.PendingUpload {
+	handlerFuncs := s.handlerFuncs.Load()
+	if handlerFuncs == nil {
+		return nil
+	}
+
+	return handlerFuncs.PendingUploads()
+}
+
+// ApproveUpload moves a pending upload into the served directory
+func (s *Server) ApproveUpload(id string) error {
+	handlerFuncs := s.handlerFuncs.Load()
+	if handlerFuncs == nil {
+		return ErrNotStarted
+	}
+
+	return handlerFuncs.ApproveUpload(id)
+}
+
+// RejectUpload deletes a pending upload
+func (s *Server) RejectUpload(id string) error {
+	handlerFuncs := s.handlerFuncs.Load()
+	if handlerFuncs == nil {
+		return ErrNotStarted
+	}
+
+	return handlerFuncs.RejectUpload(id)
+}
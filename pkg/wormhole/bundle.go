@@ -0,0 +1,192 @@
+package wormhole
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+	"github.com/psanford/wormhole-william/wormhole"
+)
+
+// Name used for the shared directory when the files
+// have no common parent other than the filesystem root
+const defaultBundleName = "snett-files"
+
+type bundleFile struct {
+	// Path of the file on disk
+	path string
+
+	// Size of the file in bytes
+	size int64
+
+	// Hex encoded SHA-256 of the file, set once it is archived
+	sha256 string
+
+	// Bytes of the file last reported as sent,
+	// -1 until the first report
+	sent int64
+}
+
+// bundle groups several files into a single
+// directory-style wormhole transfer
+type bundle struct {
+	// Name of the top level directory on the receiver
+	name string
+
+	entries []wormhole.DirectoryEntry
+	files   []*bundleFile
+
+	// Total size of all files in bytes
+	total int64
+}
+
+// newBundle prepares files for a directory transfer, keeping
+// their paths relative to the closest common parent directory
+func newBundle(files []string) (*bundle, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files provided")
+	}
+
+	paths := []string{}
+	seen := map[string]bool{}
+
+	for _, file := range files {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		paths = append(paths, path)
+	}
+
+	root := commonDir(paths)
+
+	name := filepath.Base(root)
+	if name == string(filepath.Separator) || name == "." {
+		name = defaultBundleName
+	}
+
+	b := &bundle{
+		name: name,
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.IsDir() {
+			return nil, fmt.Errorf("%v is a directory", path)
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, err
+		}
+
+		file := &bundleFile{
+			path: path,
+			size: info.Size(),
+			sent: -1,
+		}
+
+		b.entries = append(b.entries, wormhole.DirectoryEntry{
+			Path: filepath.ToSlash(filepath.Join(name, rel)),
+			Mode: info.Mode(),
+			Reader: func() (io.ReadCloser, error) {
+				f, err := os.Open(path)
+				if err != nil {
+					return nil, err
+				}
+
+				return &hashingReadCloser{
+					ReadCloser: f,
+					hash:       sha256.New(),
+					onClose: func(sum string) {
+						file.sha256 = sum
+					},
+				}, nil
+			},
+		})
+
+		b.files = append(b.files, file)
+
+		b.total += info.Size()
+	}
+
+	return b, nil
+}
+
+// commonDir returns the deepest directory containing every path
+func commonDir(paths []string) string {
+	root := filepath.Dir(paths[0])
+
+	for _, path := range paths[1:] {
+		for !isWithin(root, path) {
+			parent := filepath.Dir(root)
+			if parent == root {
+				break
+			}
+			root = parent
+		}
+	}
+
+	return root
+}
+
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// progress estimates how far along each file is from the
+// progress of the compressed archive and reports the files
+// that moved since the last update
+func (b *bundle) progress(archive models.FileShareProgress, onFileProgress func(file string, progress models.FileShareProgress)) {
+	if archive.Total <= 0 {
+		return
+	}
+
+	position := int64(float64(archive.Bytes) / float64(archive.Total) * float64(b.total))
+	if archive.Bytes >= archive.Total {
+		position = b.total
+	}
+
+	var offset int64
+
+	for _, file := range b.files {
+		sent := min(max(position-offset, 0), file.size)
+		offset += file.size
+
+		if sent == file.sent {
+			continue
+		}
+		file.sent = sent
+
+		percentage := 100
+		if file.size > 0 {
+			percentage = int((float64(sent) / float64(file.size)) * 100)
+		}
+
+		onFileProgress(file.path, models.FileShareProgress{
+			Bytes:      sent,
+			Total:      file.size,
+			Percentage: percentage,
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package wormhole
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/srv/files/a.txt", true},
+		{"/srv/files/docs/a.txt", true},
+		{"/srv/files", true},
+		{"/srv/files/../a.txt", false},
+		{"/srv/other/a.txt", false},
+		{"/srv/files-old/a.txt", false},
+		{"/srv/files/..a.txt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := isWithin("/srv/files", filepath.Clean(tt.path)); got != tt.want {
+				t.Errorf("isWithin = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBundle(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"docs/a.txt", "docs/b.txt", "photos/c.jpg"} {
+		path := filepath.Join(dir, "share", name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(name), 0644)
+	}
+
+	b, err := newBundle([]string{
+		filepath.Join(dir, "share", "docs", "a.txt"),
+		filepath.Join(dir, "share", "photos", "c.jpg"),
+		filepath.Join(dir, "share", "docs", "a.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.name != "share" {
+		t.Errorf("name = %q, want share", b.name)
+	}
+
+	want := []string{"share/docs/a.txt", "share/photos/c.jpg"}
+	if len(b.entries) != len(want) {
+		t.Fatalf("entries = %+v, want %v", b.entries, want)
+	}
+
+	for i, entry := range b.entries {
+		if entry.Path != want[i] {
+			t.Errorf("entry %v = %q, want %q", i, entry.Path, want[i])
+		}
+	}
+
+	if _, err := newBundle([]string{filepath.Join(dir, "share", "docs")}); err == nil {
+		t.Errorf("bundling a directory succeeded")
+	}
+
+	if _, err := newBundle(nil); err == nil {
+		t.Errorf("bundling no files succeeded")
+	}
+}
+
+func TestShareDirectory(t *testing.T) {
+	s := &Wormhole{}
+
+	err := s.Share(context.Background(), t.TempDir(), ShareCallBacks{}).Wait()
+	if err == nil || !strings.Contains(err.Error(), "is a directory") {
+		t.Errorf("Share = %v, want a directory error", err)
+	}
+}
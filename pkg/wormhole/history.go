@@ -0,0 +1,409 @@
+package wormhole
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/internal/logger"
+	"github.com/Owbird/SNetT-Engine/internal/utils"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+)
+
+// Name of the transfer history file in the snett dir
+const historyFileName = "history.jsonl"
+
+const (
+	// How long Add waits for another process adding to the history
+	historyLockTimeout = 5 * time.Second
+
+	// Age of a lock left behind by a process that stopped
+	// while adding to the history
+	historyLockStale = 30 * time.Second
+)
+
+// ErrRecordNotFound is returned when no transfer
+// in the history has the requested ID
+var ErrRecordNotFound = errors.New("transfer not found in history")
+
+// History is a persistent log of finished wormhole
+// transfers, stored as one JSON record per line
+type History struct {
+	// Path to the history file
+	path string
+
+	// The logger unreadable records are reported to.
+	// The application logger when nil.
+	Logger *slog.Logger
+
+	mutex sync.Mutex
+}
+
+// HistoryFilter narrows down the records returned by History.List.
+// Zero values match every record.
+type HistoryFilter struct {
+	// Only return transfers in this direction
+	Direction models.TransferDirection
+
+	// Only return transfers that ended this way
+	Outcome models.TransferOutcome
+
+	// Only return transfers whose name contains this text
+	Name string
+
+	// Only return transfers started at or after this time
+	Since time.Time
+
+	// Only return the latest Limit transfers
+	Limit int
+}
+
+func NewHistory(path string) *History {
+	return &History{
+		path: path,
+	}
+}
+
+// DefaultHistoryPath returns the path of the
+// transfer history in the snett dir
+func DefaultHistoryPath() (string, error) {
+	snettDir, err := utils.GetSNetTDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(snettDir, historyFileName), nil
+}
+
+// Path returns the path of the history file
+func (h *History) Path() string {
+	return h.path
+}
+
+// Add assigns the record the next ID and appends it to the history.
+// The history is locked while doing so, as other processes, such
+// as another wormhole command, may be adding to it as well.
+func (h *History) Add(record *models.TransferRecord) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+
+	unlock, err := h.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	records, err := h.read()
+	if err != nil {
+		return err
+	}
+
+	record.ID = 1
+	for _, r := range records {
+		record.ID = max(record.ID, r.ID+1)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// A record cut short, such as by a crash, is ended so
+	// that it does not run into the new one
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+
+	_, err = f.Write(append(line, '\n'))
+
+	return err
+}
+
+// lock keeps other processes from adding to the history until
+// the returned func is called. A lock file older than
+// historyLockStale is taken over.
+func (h *History) lock() (func(), error) {
+	lockPath := h.path + ".lock"
+	deadline := time.Now().Add(historyLockTimeout)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+
+			return func() {
+				os.Remove(lockPath)
+			}, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > historyLockStale {
+			os.Remove(lockPath)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("transfer history is locked by %v", lockPath)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// List returns the records matching filter, oldest first
+func (h *History) List(filter HistoryFilter) ([]models.TransferRecord, error) {
+	h.mutex.Lock()
+	records, err := h.read()
+	h.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []models.TransferRecord{}
+
+	for _, record := range records {
+		if filter.Direction != "" && record.Direction != filter.Direction {
+			continue
+		}
+
+		if filter.Outcome != "" && record.Outcome != filter.Outcome {
+			continue
+		}
+
+		if filter.Name != "" && !strings.Contains(strings.ToLower(record.Name), strings.ToLower(filter.Name)) {
+			continue
+		}
+
+		if !filter.Since.IsZero() && record.StartedAt.Before(filter.Since) {
+			continue
+		}
+
+		matched = append(matched, record)
+	}
+
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[len(matched)-filter.Limit:]
+	}
+
+	return matched, nil
+}
+
+// Get returns the record with the given ID
+func (h *History) Get(id int) (models.TransferRecord, error) {
+	records, err := h.List(HistoryFilter{})
+	if err != nil {
+		return models.TransferRecord{}, err
+	}
+
+	for _, record := range records {
+		if record.ID == id {
+			return record, nil
+		}
+	}
+
+	return models.TransferRecord{}, ErrRecordNotFound
+}
+
+// read returns the records of the history. Lines that are not
+// records, such as one cut short by a crash, are skipped.
+func (h *History) read() ([]models.TransferRecord, error) {
+	records := []models.TransferRecord{}
+
+	f, err := os.Open(h.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return records, nil
+		}
+		return records, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return records, fmt.Errorf("failed to read transfer history: %w", err)
+		}
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record models.TransferRecord
+
+			if decodeErr := json.Unmarshal(line, &record); decodeErr != nil {
+				h.logger().Warn("Skipping unreadable transfer history record", "path", h.path, "line", lineNumber, "err", decodeErr)
+			} else {
+				records = append(records, record)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+func (h *History) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+
+	return logger.Logger
+}
+
+// newRecord starts a history record for a transfer
+func newRecord(direction models.TransferDirection) *models.TransferRecord {
+	return &models.TransferRecord{
+		Direction: direction,
+		Files:     []models.TransferFile{},
+		StartedAt: time.Now(),
+	}
+}
+
+// record completes the transfer record with the result of the
+// transfer, adds it to the history and publishes it on Events
+func (s *Wormhole) record(record *models.TransferRecord, err error) {
+	record.FinishedAt = time.Now()
+
+	switch {
+	case err == nil:
+		record.Outcome = models.TRANSFER_COMPLETED
+	case errors.Is(err, ErrTransferCancelled), errors.Is(err, context.Canceled):
+		record.Outcome = models.TRANSFER_CANCELLED
+		record.Error = err.Error()
+	default:
+		record.Outcome = models.TRANSFER_FAILED
+		record.Error = err.Error()
+	}
+
+	for _, file := range record.Files {
+		record.Size += file.Size
+	}
+
+	if s.History != nil {
+		if err := s.History.Add(record); err != nil {
+			s.Logger.Error("Failed to save transfer history", "err", err)
+		}
+	}
+
+	s.Events.Publish(events.TransferFinished{
+		ID:        record.ID,
+		Direction: record.Direction,
+		Name:      record.Name,
+		Size:      record.Size,
+		Outcome:   record.Outcome,
+		Error:     record.Error,
+		Duration:  record.FinishedAt.Sub(record.StartedAt),
+	})
+}
+
+// hashingReadSeeker computes the SHA-256 of everything read
+// from a file, starting over whenever it is rewound
+type hashingReadSeeker struct {
+	io.ReadSeeker
+	hash hash.Hash
+}
+
+func newHashingReadSeeker(r io.ReadSeeker) *hashingReadSeeker {
+	return &hashingReadSeeker{
+		ReadSeeker: r,
+		hash:       sha256.New(),
+	}
+}
+
+func (r *hashingReadSeeker) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	r.hash.Write(p[:n])
+
+	return n, err
+}
+
+func (r *hashingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.ReadSeeker.Seek(offset, whence)
+	if err == nil && pos == 0 {
+		r.hash.Reset()
+	}
+
+	return pos, err
+}
+
+// Sum returns the hex encoded SHA-256 of the data read so far
+func (r *hashingReadSeeker) Sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+// hashingReadCloser computes the SHA-256 of everything read
+// and hands it to onClose once the reader is closed
+type hashingReadCloser struct {
+	io.ReadCloser
+	hash    hash.Hash
+	onClose func(sum string)
+}
+
+func (r *hashingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+
+	return n, err
+}
+
+func (r *hashingReadCloser) Close() error {
+	r.onClose(hex.EncodeToString(r.hash.Sum(nil)))
+
+	return r.ReadCloser.Close()
+}
+
+// Resend shares the files of a transfer in the
+// history again with a fresh code
+func (s *Wormhole) Resend(ctx context.Context, id int, callbacks ShareCallBacks) (*Transfer, error) {
+	if s.History == nil {
+		return nil, errors.New("transfer history is disabled")
+	}
+
+	record, err := s.History.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, file := range record.Files {
+		files = append(files, file.Path)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("transfer %v has no files to share", id)
+	}
+
+	return s.ShareFiles(ctx, files, callbacks), nil
+}
@@ -0,0 +1,197 @@
+package wormhole
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+)
+
+func newTestHistory(path string) *History {
+	h := NewHistory(path)
+	h.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	return h
+}
+
+func TestHistoryAdd(t *testing.T) {
+	h := newTestHistory(filepath.Join(t.TempDir(), "snett", historyFileName))
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		record := newRecord(models.TRANSFER_SENT)
+		record.Name = name
+		record.Outcome = models.TRANSFER_COMPLETED
+
+		if err := h.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := h.List(HistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[0].ID != 1 || records[1].ID != 2 || records[1].Name != "b.txt" {
+		t.Fatalf("records = %+v", records)
+	}
+
+	if _, err := os.Stat(h.Path() + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock left behind: %v", err)
+	}
+}
+
+func TestHistorySkipsBadLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFileName)
+
+	// A record cut short by a crash while appending
+	content := `{"id":1,"name":"a.txt","outcome":"completed"}
+not json
+{"id":2,"name":"b.t`
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newTestHistory(path)
+
+	if err := h.Add(&models.TransferRecord{Name: "c.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := h.List(HistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[0].Name != "a.txt" || records[1].Name != "c.txt" || records[1].ID != 2 {
+		t.Fatalf("records = %+v", records)
+	}
+}
+
+func TestHistoryAddFromSeveralProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFileName)
+
+	// Separate histories share no mutex, like separate processes
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := newTestHistory(path).Add(&models.TransferRecord{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	records, err := newTestHistory(path).List(HistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[int]bool{}
+	for _, record := range records {
+		if seen[record.ID] {
+			t.Errorf("ID %v assigned twice", record.ID)
+		}
+		seen[record.ID] = true
+	}
+
+	if len(records) != 10 {
+		t.Errorf("got %v records, want 10", len(records))
+	}
+}
+
+func TestHistoryStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFileName)
+	lockPath := path + ".lock"
+
+	if err := os.WriteFile(lockPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * historyLockStale)
+	os.Chtimes(lockPath, old, old)
+
+	if err := newTestHistory(path).Add(&models.TransferRecord{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+	h := newTestHistory(filepath.Join(t.TempDir(), historyFileName))
+
+	now := time.Now()
+	records := []models.TransferRecord{
+		{Name: "Report.pdf", Direction: models.TRANSFER_SENT, Outcome: models.TRANSFER_COMPLETED, StartedAt: now.Add(-48 * time.Hour)},
+		{Name: "photo.jpg", Direction: models.TRANSFER_RECEIVED, Outcome: models.TRANSFER_FAILED, StartedAt: now.Add(-time.Hour)},
+		{Name: "notes.txt", Direction: models.TRANSFER_SENT, Outcome: models.TRANSFER_CANCELLED, StartedAt: now},
+	}
+
+	for i := range records {
+		if err := h.Add(&records[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter HistoryFilter
+		want   []string
+	}{
+		{"all", HistoryFilter{}, []string{"Report.pdf", "photo.jpg", "notes.txt"}},
+		{"direction", HistoryFilter{Direction: models.TRANSFER_SENT}, []string{"Report.pdf", "notes.txt"}},
+		{"outcome", HistoryFilter{Outcome: models.TRANSFER_FAILED}, []string{"photo.jpg"}},
+		{"name ignores case", HistoryFilter{Name: "report"}, []string{"Report.pdf"}},
+		{"since", HistoryFilter{Since: now.Add(-2 * time.Hour)}, []string{"photo.jpg", "notes.txt"}},
+		{"limit keeps the latest", HistoryFilter{Limit: 1}, []string{"notes.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := h.List(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, record := range records {
+				names = append(names, record.Name)
+			}
+
+			if len(names) != len(tt.want) {
+				t.Fatalf("names = %v, want %v", names, tt.want)
+			}
+
+			for i := range names {
+				if names[i] != tt.want[i] {
+					t.Fatalf("names = %v, want %v", names, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultHistoryPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	w := NewWormhole(nil)
+
+	if want := filepath.Join(home, ".snett", historyFileName); w.History.Path() != want {
+		t.Fatalf("history path = %v, want %v", w.History.Path(), want)
+	}
+
+	w.History.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if err := w.History.Add(&models.TransferRecord{}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,377 @@
+package wormhole
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Owbird/SNetT-Engine/pkg/models"
+	"github.com/psanford/wormhole-william/wormhole"
+)
+
+// Name used to save text messages received through the wormhole
+const textMessageName = "wormhole-message.txt"
+
+// ReceiveCallBacks defines a set of callback functions for handling file receiving events.
+type ReceiveCallBacks struct {
+	// OnFileReceived is called with the saved path once the file or directory has been received.
+	OnFileReceived func(path string)
+
+	// OnReceiveErr is called when an error occurs during the file receiving process.
+	OnReceiveErr func(err error)
+
+	// OnProgressChange is called to provide updates on the progress of the file receiving operation.
+	OnProgressChange func(progress models.FileShareProgress)
+
+	// OnOffer is called with the name of the file or directory offered before it is
+	// accepted. Returning an error rejects the transfer with that error.
+	OnOffer func(name string, isDir bool) error
+}
+
+// Receive receives a file from a device through a wormhole
+// and saves it to the snett dir in the Downloads directory.
+// The receive runs in the background until it completes,
+// ctx is done or the returned Transfer is cancelled.
+func (s *Wormhole) Receive(ctx context.Context, code string) *Transfer {
+	return s.ReceiveTo(ctx, code, "", ReceiveCallBacks{})
+}
+
+// ReceiveTo receives a file or directory from a device through a
+// wormhole and saves it to dir, such as a directory being served.
+// An empty dir saves to the snett dir in the Downloads directory.
+// Existing files are never overwritten; a numbered name is used instead.
+func (s *Wormhole) ReceiveTo(ctx context.Context, code, dir string, callbacks ReceiveCallBacks) *Transfer {
+	t := newTransfer(ctx)
+	record := newRecord(models.TRANSFER_RECEIVED)
+
+	t.run(func() error {
+		path, err := s.receive(t, record, code, dir, callbacks)
+		s.record(record, err)
+
+		if err != nil {
+			if callbacks.OnReceiveErr != nil {
+				callbacks.OnReceiveErr(err)
+			}
+
+			return err
+		}
+
+		if callbacks.OnFileReceived != nil {
+			callbacks.OnFileReceived(path)
+		}
+
+		return nil
+	})
+
+	return t
+}
+
+func (s *Wormhole) receive(
+	t *Transfer,
+	record *models.TransferRecord,
+	code, dir string,
+	callbacks ReceiveCallBacks,
+) (string, error) {
+	var c wormhole.Client
+
+	stopPairing := s.startPairingTimer(t)
+	fileInfo, err := c.Receive(t.ctx, code)
+	stopPairing()
+	if err != nil {
+		return "", t.cause(err)
+	}
+
+	record.Name = filepath.Base(fileInfo.Name)
+	if fileInfo.Type == wormhole.TransferText || fileInfo.Name == "" {
+		record.Name = textMessageName
+	}
+
+	if callbacks.OnOffer != nil {
+		if err := callbacks.OnOffer(record.Name, fileInfo.Type == wormhole.TransferDirectory); err != nil {
+			fileInfo.Reject()
+			return "", err
+		}
+	}
+
+	if fileInfo.Type == wormhole.TransferDirectory {
+		if err := s.checkReceiveLimits(fileInfo.FileCount, fileInfo.UncompressedBytes64); err != nil {
+			fileInfo.Reject()
+			return "", err
+		}
+	}
+
+	if dir == "" {
+		dir, err = downloadsDir()
+		if err != nil {
+			fileInfo.Reject()
+			return "", err
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fileInfo.Reject()
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	r := &progressReader{
+		Reader:     fileInfo,
+		total:      fileInfo.TransferBytes64,
+		onProgress: callbacks.OnProgressChange,
+	}
+
+	var destPath string
+
+	if fileInfo.Type == wormhole.TransferDirectory {
+		destPath, err = uniquePath(filepath.Join(dir, record.Name), func(path string) error {
+			return os.Mkdir(path, 0755)
+		})
+		if err != nil {
+			fileInfo.Reject()
+			return "", fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		files, err := s.saveDirectory(r, destPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to save directory: %w", t.cause(err))
+		}
+
+		record.Files = append(record.Files, files...)
+	} else {
+		var f *os.File
+
+		destPath, err = uniquePath(filepath.Join(dir, record.Name), func(path string) error {
+			f, err = createFile(path)
+			return err
+		})
+		if err != nil {
+			fileInfo.Reject()
+			return "", fmt.Errorf("failed to save file: %w", err)
+		}
+
+		file, err := saveFile(r, f)
+		if err != nil {
+			return "", fmt.Errorf("failed to save file: %w", t.cause(err))
+		}
+
+		record.Files = append(record.Files, file)
+	}
+
+	s.sendNotification(models.Notification{
+		Title: "File received",
+		Body:  fmt.Sprintf("File %v received and saved to %v", record.Name, destPath),
+	})
+
+	return destPath, nil
+}
+
+func downloadsDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, "Downloads", "snett"), nil
+}
+
+// uniquePath calls create with path, or a numbered variant of it
+// such as "file (1).txt" while create fails because the path already
+// exists, and returns the path that was created. Creating and checking
+// are one step, so a file appearing in the meantime is never replaced.
+func uniquePath(path string, create func(path string) error) (string, error) {
+	err := create(path)
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	for i := 1; errors.Is(err, fs.ErrExist); i++ {
+		path = fmt.Sprintf("%v (%v)%v", base, i, ext)
+		err = create(path)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// createFile creates a file at path, failing with
+// fs.ErrExist instead of replacing an existing one
+func createFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+}
+
+// saveFile writes r to f and closes it, removing
+// the partial file if anything goes wrong
+func saveFile(r io.Reader, f *os.File) (models.TransferFile, error) {
+	hash := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(f, hash), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return models.TransferFile{}, err
+	}
+
+	return models.TransferFile{
+		Path:   f.Name(),
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// checkReceiveLimits returns ErrReceiveTooLarge if files or
+// size are beyond the receive limits
+func (s *Wormhole) checkReceiveLimits(files int, size int64) error {
+	if s.MaxReceiveFiles > 0 && files > s.MaxReceiveFiles {
+		return fmt.Errorf("%w: %v files, at most %v allowed", ErrReceiveTooLarge, files, s.MaxReceiveFiles)
+	}
+
+	if s.MaxReceiveSize > 0 && size > s.MaxReceiveSize {
+		return fmt.Errorf("%w: %v bytes, at most %v allowed", ErrReceiveTooLarge, size, s.MaxReceiveSize)
+	}
+
+	return nil
+}
+
+// saveDirectory extracts the zip archive of a directory transfer
+// read from r into dir. The sizes in the archive are not trusted:
+// the bytes actually extracted are counted against the limits.
+func (s *Wormhole) saveDirectory(r io.Reader, dir string) ([]models.TransferFile, error) {
+	archive, err := os.CreateTemp("", "snett-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	size, err := io.Copy(archive, r)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkReceiveLimits(len(zr.File), 0); err != nil {
+		return nil, err
+	}
+
+	files := []models.TransferFile{}
+
+	// Bytes still allowed to be extracted
+	remaining := int64(-1)
+	if s.MaxReceiveSize > 0 {
+		remaining = s.MaxReceiveSize
+	}
+
+	for _, entry := range zr.File {
+		path := filepath.Join(dir, filepath.FromSlash(entry.Name))
+		if !isWithin(dir, path) {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("invalid path %q in archive", entry.Name)
+		}
+
+		if entry.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				os.RemoveAll(dir)
+				return nil, err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+
+		file, err := saveEntry(entry, path, remaining)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+
+		if remaining >= 0 {
+			remaining -= file.Size
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// saveEntry extracts entry to path, failing with ErrReceiveTooLarge
+// if it holds more than limit bytes. A negative limit allows any size.
+func saveEntry(entry *zip.File, path string, limit int64) (models.TransferFile, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return models.TransferFile{}, err
+	}
+	defer rc.Close()
+
+	f, err := createFile(path)
+	if err != nil {
+		return models.TransferFile{}, err
+	}
+
+	if limit < 0 {
+		return saveFile(rc, f)
+	}
+
+	// One byte past the limit tells a full entry from a larger one
+	file, err := saveFile(io.LimitReader(rc, limit+1), f)
+	if err != nil {
+		return file, err
+	}
+
+	if file.Size > limit {
+		os.Remove(path)
+		return models.TransferFile{}, fmt.Errorf("%w: more than %v bytes once extracted", ErrReceiveTooLarge, limit)
+	}
+
+	return file, nil
+}
+
+// progressReader reports how much of a
+// transfer has been read so far
+type progressReader struct {
+	io.Reader
+
+	read       int64
+	total      int64
+	onProgress func(progress models.FileShareProgress)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+
+	if n > 0 && r.onProgress != nil {
+		r.read += int64(n)
+
+		percentage := 100
+		if r.total > 0 {
+			percentage = int((float64(r.read) / float64(r.total)) * 100)
+		}
+
+		r.onProgress(models.FileShareProgress{
+			Bytes:      r.read,
+			Total:      r.total,
+			Percentage: percentage,
+		})
+	}
+
+	return n, err
+}
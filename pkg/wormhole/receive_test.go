@@ -0,0 +1,145 @@
+package wormhole
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zipOf archives files, keyed by their path in the archive
+func zipOf(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w.Write([]byte(content))
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &buf
+}
+
+func TestSaveDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		maxFiles int
+		maxSize  int64
+		wantErr  error
+	}{
+		{"within the limits", map[string]string{"docs/a.txt": "hello", "b.txt": "world"}, 2, 10, nil},
+		{"no limits", map[string]string{"a.txt": strings.Repeat("a", 1000)}, 0, 0, nil},
+		{"too many files", map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c"}, 2, 0, ErrReceiveTooLarge},
+		{"too large once extracted", map[string]string{"a.txt": strings.Repeat("a", 1<<20)}, 0, 1 << 10, ErrReceiveTooLarge},
+		{"too large across files", map[string]string{"a.txt": "hello", "b.txt": "world"}, 0, 9, ErrReceiveTooLarge},
+		{"outside the directory", map[string]string{"../evil.txt": "evil"}, 0, 0, errors.New("invalid path")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "received")
+
+			s := &Wormhole{MaxReceiveFiles: tt.maxFiles, MaxReceiveSize: tt.maxSize}
+
+			files, err := s.saveDirectory(zipOf(t, tt.files), dir)
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(files) != len(tt.files) {
+					t.Errorf("saved %v files, want %v", len(files), len(tt.files))
+				}
+
+				return
+			}
+
+			if err == nil || (!errors.Is(err, tt.wantErr) && !strings.Contains(err.Error(), tt.wantErr.Error())) {
+				t.Fatalf("saveDirectory = %v, want %v", err, tt.wantErr)
+			}
+
+			if _, err := os.Stat(filepath.Join(parent, "evil.txt")); !os.IsNotExist(err) {
+				t.Errorf("file written outside the directory")
+			}
+
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("partial directory left behind: %v", err)
+			}
+		})
+	}
+}
+
+// createAndClose creates a file the way a receive does
+func createAndClose(path string) error {
+	f, err := createFile(path)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func TestUniquePath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+
+	if got, err := uniquePath(path, createAndClose); err != nil || got != path {
+		t.Errorf("uniquePath = %v, %v, want %v", got, err, path)
+	}
+
+	os.WriteFile(filepath.Join(dir, "a (1).txt"), nil, 0644)
+
+	if got, err := uniquePath(path, createAndClose); err != nil || got != filepath.Join(dir, "a (2).txt") {
+		t.Errorf("uniquePath = %v, %v, want a (2).txt", got, err)
+	}
+}
+
+func TestUniquePathRace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+
+	got, err := uniquePath(path, func(candidate string) error {
+		// Another process saves the same name right before this one
+		if candidate == path {
+			os.WriteFile(path, []byte("theirs"), 0644)
+		}
+
+		return createAndClose(candidate)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != filepath.Join(dir, "a (1).txt") {
+		t.Errorf("uniquePath = %v, want a (1).txt", got)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "theirs" {
+		t.Errorf("existing file replaced, now %q", data)
+	}
+}
+
+func TestUniquePathError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "a.txt")
+
+	if _, err := uniquePath(path, createAndClose); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("uniquePath = %v, want fs.ErrNotExist", err)
+	}
+}
@@ -2,17 +2,48 @@ package wormhole
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"sync"
+	"time"
 
+	"github.com/Owbird/SNetT-Engine/internal/logger"
 	"github.com/Owbird/SNetT-Engine/pkg/config"
+	"github.com/Owbird/SNetT-Engine/pkg/events"
 	"github.com/Owbird/SNetT-Engine/pkg/models"
 	"github.com/psanford/wormhole-william/wormhole"
 )
 
+// DefaultPairingTimeout is how long a transfer waits for
+// the other device before giving up
+const DefaultPairingTimeout = 10 * time.Minute
+
+const (
+	// DefaultMaxReceiveFiles is how many files a received
+	// directory may hold
+	DefaultMaxReceiveFiles = 10000
+
+	// DefaultMaxReceiveSize is how many bytes a received
+	// directory may hold once extracted
+	DefaultMaxReceiveSize = 10 << 30
+)
+
+var (
+	// ErrPairingTimeout is returned when the other device
+	// does not connect within the pairing timeout
+	ErrPairingTimeout = errors.New("timed out waiting for the other device")
+
+	// ErrTransferCancelled is returned when a transfer is
+	// stopped through Transfer.Cancel
+	ErrTransferCancelled = errors.New("transfer cancelled")
+
+	// ErrReceiveTooLarge is returned when a received directory
+	// holds more files or bytes than the receive limits allow
+	ErrReceiveTooLarge = errors.New("received directory is too large")
+)
+
 // ShareCallBacks defines a set of callback functions for handling file sharing events.
 type ShareCallBacks struct {
 	// OnFileSent is called when a file has been successfully sent.
@@ -26,145 +57,370 @@ type ShareCallBacks struct {
 
 	// OnCodeReceive is called when the code to initiate the file sharing process has been received.
 	OnCodeReceive func(code string)
+
+	// OnFileProgressChange is called with the estimated progress of each file
+	// when several files are shared together.
+	OnFileProgressChange func(file string, progress models.FileShareProgress)
 }
 
 type Wormhole struct {
-	// The channel to send the logs through
-	logCh chan models.ServerLog
+	// The app configuration, used for notifications
+	appConfig *config.AppConfig
+
+	// The logger used by the transfers
+	Logger *slog.Logger
+
+	// How long to wait for the other device to connect.
+	// Zero or less waits until the context is done.
+	PairingTimeout time.Duration
+
+	// How many files and bytes a received directory may hold
+	// once extracted, as a small zip archive can expand to
+	// fill the disk. Zero or less allows any amount.
+	MaxReceiveFiles int
+	MaxReceiveSize  int64
+
+	// Where finished transfers are recorded.
+	// Nil disables the transfer history.
+	History *History
+
+	// Where the transfer events are published, such as for
+	// hooks. Nil publishes none.
+	Events *events.Bus
+
+	// Skip the desktop notification and clipboard copy, such as
+	// for transfers started by visitors of the file server
+	DisableNotifications bool
 }
 
+// Transfer is a handle to a running share or receive
+type Transfer struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+	err    error
+}
 
-var appConfig = config.NewAppConfig()
+func (s *Wormhole) sendNotification(notif models.Notification) {
+	if s.DisableNotifications {
+		return
+	}
 
-func sendNotification(notif models.Notification) {
-	appConfig.GetNotifConfig().SendNotification(models.Notification{
+	s.appConfig.GetNotifConfig().SendNotification(s.Logger, models.Notification{
 		Title:         notif.Title,
 		Body:          notif.Body,
 		ClipboardText: notif.ClipboardText,
 	})
 }
 
-func NewWormhole(logCh chan models.ServerLog) *Wormhole {
-	return &Wormhole{
-		logCh: logCh,
+// NewWormhole returns a wormhole using appConfig, or
+// the default configuration when appConfig is nil
+func NewWormhole(appConfig *config.AppConfig) *Wormhole {
+	if appConfig == nil {
+		appConfig = config.Default()
 	}
-}
 
-// Send a file through a wormhole from a device
-// TODO: Support directories
-func (s *Wormhole) Share(file string, callbacks ShareCallBacks) {
-	f, err := os.Open(file)
-	if err != nil {
-		callbacks.OnSendErr(err)
+	w := &Wormhole{
+		appConfig:      appConfig,
+		Logger:         logger.Logger,
+		PairingTimeout: DefaultPairingTimeout,
 
-		return
+		MaxReceiveFiles: DefaultMaxReceiveFiles,
+		MaxReceiveSize:  DefaultMaxReceiveSize,
 	}
 
-	var c wormhole.Client
-	ctx := context.Background()
+	if historyPath, err := DefaultHistoryPath(); err == nil {
+		w.History = NewHistory(historyPath)
+	}
 
-	progressCh := make(chan models.FileShareProgress, 1)
+	return w
+}
 
-	handleProgress := func(sentBytes int64, totalBytes int64) {
-		progressCh <- models.FileShareProgress{
-			Bytes:      sentBytes,
-			Total:      totalBytes,
-			Percentage: int((float64(sentBytes) / float64(totalBytes)) * 100),
-		}
+// CodeURI returns code as a wormhole: URI, suitable
+// for QR codes scanned by the receiving device
+func CodeURI(code string) string {
+	return "wormhole:" + code
+}
+
+func newTransfer(ctx context.Context) *Transfer {
+	if ctx == nil {
+		ctx = context.Background()
 	}
 
-	code, st, err := c.SendFile(ctx, file, f, wormhole.WithProgress(handleProgress))
+	ctx, cancel := context.WithCancelCause(ctx)
 
-	if err != nil && callbacks.OnSendErr != nil {
-		callbacks.OnSendErr(err)
+	return &Transfer{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
 
-		return
+// run executes fn in the background and records its
+// result once it returns
+func (t *Transfer) run(fn func() error) {
+	go func() {
+		t.err = fn()
+		t.cancel(nil)
+		close(t.done)
+	}()
+}
+
+// Cancel stops the transfer. It is safe to call
+// more than once and after the transfer is done.
+func (t *Transfer) Cancel() {
+	t.cancel(ErrTransferCancelled)
+}
+
+// Done is closed once the transfer has finished
+func (t *Transfer) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait blocks until the transfer has finished and
+// returns its error, if any
+func (t *Transfer) Wait() error {
+	<-t.done
+
+	return t.err
+}
+
+// cause returns the reason the transfer was stopped
+// in place of err when the context is done
+func (t *Transfer) cause(err error) error {
+	if t.ctx.Err() != nil {
+		return context.Cause(t.ctx)
 	}
 
-	if callbacks.OnCodeReceive != nil {
-		callbacks.OnCodeReceive(code)
+	return err
+}
 
-		sendNotification(models.Notification{
-			Title:         "Share code received",
-			Body:          "Code copied to clipboard.",
-			ClipboardText: code,
-		})
+// startPairingTimer cancels the transfer if the other
+// device has not connected before the pairing timeout.
+// The returned func stops the timer.
+func (s *Wormhole) startPairingTimer(t *Transfer) func() {
+	if s.PairingTimeout <= 0 {
+		return func() {}
 	}
 
-	wg := sync.WaitGroup{}
+	timer := time.AfterFunc(s.PairingTimeout, func() {
+		t.cancel(ErrPairingTimeout)
+	})
 
-	wg.Add(1)
-	go func() {
-		for {
-			select {
-			case status := <-st:
-				if status.Error != nil && callbacks.OnSendErr != nil {
-					callbacks.OnSendErr(status.Error)
+	return func() {
+		timer.Stop()
+	}
+}
 
-					return
-				}
+// Share sends a file through a wormhole from a device.
+// Only single files are accepted; directories fail.
+// The share runs in the background until it completes,
+// ctx is done or the returned Transfer is cancelled.
+func (s *Wormhole) Share(ctx context.Context, file string, callbacks ShareCallBacks) *Transfer {
+	t := newTransfer(ctx)
+	record := newRecord(models.TRANSFER_SENT)
+
+	t.run(func() error {
+		err := s.shareFile(t, record, file, callbacks)
+		s.record(record, err)
+		if err != nil && callbacks.OnSendErr != nil {
+			callbacks.OnSendErr(err)
+		}
 
-				if !status.OK && status.Error != nil && callbacks.OnSendErr != nil {
-					callbacks.OnSendErr(fmt.Errorf("unknown error occurred"))
-					return
+		return err
+	})
 
-				} else {
-					if callbacks.OnFileSent != nil {
-						callbacks.OnFileSent()
-					}
+	return t
+}
 
-					wg.Done()
-					return
-				}
+// ShareFiles sends several files through a wormhole with a single
+// code. The files are bundled as one directory named after their
+// closest common parent, keeping their paths relative to it.
+func (s *Wormhole) ShareFiles(ctx context.Context, files []string, callbacks ShareCallBacks) *Transfer {
+	if len(files) == 1 {
+		return s.Share(ctx, files[0], callbacks)
+	}
 
-			case progress := <-progressCh:
-				if callbacks.OnProgressChange != nil {
-					callbacks.OnProgressChange(progress)
-				}
-			}
+	t := newTransfer(ctx)
+	record := newRecord(models.TRANSFER_SENT)
+
+	t.run(func() error {
+		err := s.shareFiles(t, record, files, callbacks)
+		s.record(record, err)
+		if err != nil && callbacks.OnSendErr != nil {
+			callbacks.OnSendErr(err)
 		}
-	}()
 
-	wg.Wait()
+		return err
+	})
+
+	return t
 }
 
-// Receive file from device through wormhole
-// Saves file to the snett dir in the Downloads directory
-func (s *Wormhole) Receive(code string) error {
-	var c wormhole.Client
+func (s *Wormhole) shareFile(t *Transfer, record *models.TransferRecord, file string, callbacks ShareCallBacks) error {
+	record.Name = filepath.Base(file)
 
-	ctx := context.Background()
-	fileInfo, err := c.Receive(ctx, code)
+	path, err := filepath.Abs(file)
 	if err != nil {
 		return err
 	}
 
-	homeDir, err := os.UserHomeDir()
+	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to determine home directory: %w", err)
+		return err
 	}
-	downloadsDir := filepath.Join(homeDir, "Downloads", "snett")
+	defer f.Close()
 
-	if err := os.MkdirAll(downloadsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create snett directory: %w", err)
+	info, err := f.Stat()
+	if err != nil {
+		return err
 	}
 
-	destFilePath := filepath.Join(downloadsDir, filepath.Base(fileInfo.Name))
-	destFile, err := os.Create(destFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+	if info.IsDir() {
+		return fmt.Errorf("%v is a directory", path)
+	}
+
+	record.Files = append(record.Files, models.TransferFile{
+		Path: path,
+		Size: info.Size(),
+	})
+
+	var c wormhole.Client
+
+	r := newHashingReadSeeker(f)
+
+	err = s.send(t, record, callbacks, func(opts ...wormhole.SendOption) (string, chan wormhole.SendResult, error) {
+		return c.SendFile(t.ctx, file, r, opts...)
+	})
+	if err == nil {
+		record.Files[0].SHA256 = r.Sum()
 	}
-	defer destFile.Close()
 
-	_, err = io.Copy(destFile, fileInfo)
+	return err
+}
+
+func (s *Wormhole) shareFiles(t *Transfer, record *models.TransferRecord, files []string, callbacks ShareCallBacks) error {
+	b, err := newBundle(files)
 	if err != nil {
-		return fmt.Errorf("failed to save file: %w", err)
+		return err
 	}
 
-	sendNotification(models.Notification{
-		Title: "File received",
-		Body:  fmt.Sprintf("File %v received and saved to %v", filepath.Base(fileInfo.Name), destFilePath),
+	record.Name = b.name
+	defer func() {
+		for _, file := range b.files {
+			record.Files = append(record.Files, models.TransferFile{
+				Path:   file.path,
+				Size:   file.size,
+				SHA256: file.sha256,
+			})
+		}
+	}()
+
+	var c wormhole.Client
+
+	bundleCallbacks := callbacks
+	bundleCallbacks.OnProgressChange = func(progress models.FileShareProgress) {
+		if callbacks.OnProgressChange != nil {
+			callbacks.OnProgressChange(progress)
+		}
+
+		if callbacks.OnFileProgressChange != nil {
+			b.progress(progress, callbacks.OnFileProgressChange)
+		}
+	}
+
+	return s.send(t, record, bundleCallbacks, func(opts ...wormhole.SendOption) (string, chan wormhole.SendResult, error) {
+		return c.SendDirectory(t.ctx, b.name, b.entries, opts...)
 	})
+}
+
+// send starts a transfer with the given send function and
+// reports its code, progress and result through callbacks
+func (s *Wormhole) send(
+	t *Transfer,
+	record *models.TransferRecord,
+	callbacks ShareCallBacks,
+	sendFn func(opts ...wormhole.SendOption) (string, chan wormhole.SendResult, error),
+) error {
+	progressCh := make(chan models.FileShareProgress, 1)
+
+	handleProgress := func(sentBytes int64, totalBytes int64) {
+		select {
+		case progressCh <- models.FileShareProgress{
+			Bytes:      sentBytes,
+			Total:      totalBytes,
+			Percentage: int((float64(sentBytes) / float64(totalBytes)) * 100),
+		}:
+		case <-t.ctx.Done():
+		}
+	}
 
-	return nil
+	code, st, err := sendFn(wormhole.WithProgress(handleProgress))
+	if err != nil {
+		return t.cause(err)
+	}
+
+	stopPairing := s.startPairingTimer(t)
+	defer stopPairing()
+
+	reportProgress := func(progress models.FileShareProgress) {
+		stopPairing()
+
+		if callbacks.OnProgressChange != nil {
+			callbacks.OnProgressChange(progress)
+		}
+	}
+
+	if callbacks.OnCodeReceive != nil {
+		callbacks.OnCodeReceive(code)
+
+		s.sendNotification(models.Notification{
+			Title:         "Share code received",
+			Body:          "Code copied to clipboard.",
+			ClipboardText: code,
+		})
+	}
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return context.Cause(t.ctx)
+
+		case status, ok := <-st:
+			stopPairing()
+
+			// Report the final progress update if it is still pending
+			select {
+			case progress := <-progressCh:
+				reportProgress(progress)
+			default:
+			}
+
+			if !ok {
+				return t.cause(fmt.Errorf("unknown error occurred"))
+			}
+
+			if status.Error != nil {
+				return t.cause(status.Error)
+			}
+
+			if !status.OK {
+				return fmt.Errorf("unknown error occurred")
+			}
+
+			if callbacks.OnFileSent != nil {
+				callbacks.OnFileSent()
+			}
+
+			s.sendNotification(models.Notification{
+				Title: "File sent",
+				Body:  fmt.Sprintf("%v was received by the other device", record.Name),
+			})
+
+			return nil
+
+		case progress := <-progressCh:
+			reportProgress(progress)
+		}
+	}
 }